@@ -18,6 +18,7 @@ import (
 
 	"github.com/vuisme/litecart/internal/middleware"
 	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/reconcile"
 	"github.com/vuisme/litecart/internal/routes"
 	"github.com/vuisme/litecart/migrations"
 	"github.com/vuisme/litecart/pkg/fsutil"
@@ -46,11 +47,15 @@ func NewApp(httpAddr, httpsAddr string, noSite, appDev bool) error {
 		mainAddr = httpsAddr
 	}
 
+	queries.DevMode = DevMode
 	if err := queries.New(migrations.Embed()); err != nil {
 		log.Err(err).Send()
 		return err
 	}
 
+	// check pending carts with the payment systems
+	reconcile.Start(ctx)
+
 	// web web server
 	fiberConfig := fiber.Config{
 		// Prefork:               true,
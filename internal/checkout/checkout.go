@@ -0,0 +1,136 @@
+package checkout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vuisme/litecart/internal/mailer"
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/logging"
+)
+
+// UpdatePayment stores the status of the payment in the cart. A paid payment
+// that does not match the amount or currency of the cart gets the amount_mismatch
+// status instead and is reported to the admin. Paid and mismatched statuses are
+// stored only once, the returned value is false when another notification has
+// already stored them. A paid cart whose keys can not be given gets the
+// out_of_stock status and is reported to the admin. A letter that fails is logged and not retried by the next
+// notification, the admin can send it again.
+func UpdatePayment(ctx context.Context, cart *models.Cart, payment *litepay.Payment) (bool, error) {
+	db := queries.DB()
+	log := logging.New()
+
+	if payment.Status.Paid() && !payment.Match(cart.AmountTotal, cart.Currency) {
+		payment.Status = litepay.AMOUNT_MISMATCH
+	}
+
+	update := &models.Cart{
+		Core: models.Core{
+			ID: cart.ID,
+		},
+		PaymentID:     payment.MerchantID,
+		PaymentStatus: payment.Status,
+		PaymentSystem: cart.PaymentSystem,
+	}
+
+	switch {
+	case payment.Status.Paid():
+		if payment.AmountDiscount > 0 {
+			update.AmountPaid = payment.AmountTotal
+		}
+		paid, err := db.PayCart(ctx, update)
+		if errors.Is(err, errors.ErrNotEnoughKeys) {
+			return outOfStock(ctx, cart, payment, update, err)
+		}
+		if err != nil || !paid {
+			return false, err
+		}
+
+		if payment.Subscription != nil {
+			if err := db.AddSubscription(ctx, cart, payment.Subscription); err != nil {
+				log.ErrorStack(err)
+			}
+		}
+
+		if err := mailer.SendCartLetter(cart.ID); err != nil {
+			log.ErrorStack(err)
+		}
+
+	case payment.Status == litepay.AMOUNT_MISMATCH:
+		update.AmountPaid = payment.AmountTotal
+		update.CurrencyPaid = strings.ToUpper(payment.Currency)
+		mismatched, err := db.MismatchCart(ctx, update)
+		if err != nil || !mismatched {
+			return false, err
+		}
+
+		log.Warn().
+			Str("cart_id", cart.ID).
+			Int("amount_total", payment.AmountTotal).
+			Str("currency", payment.Currency).
+			Msg("payment does not match the cart")
+		if err := mailer.SendMismatchLetter(cart.ID); err != nil {
+			log.ErrorStack(err)
+		}
+
+	default:
+		if err := db.UpdateCart(ctx, update); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// PaymentHook returns the webhook of a payment stored by UpdatePayment, with the
+// amount of the cart and, once it is paid, its discount.
+func PaymentHook(event webhook.Event, cart *models.Cart, payment *litepay.Payment) *webhook.Payment {
+	hook := &webhook.Payment{
+		Event:     event,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			CartID:        cart.ID,
+			PaymentSystem: cart.PaymentSystem,
+			PaymentStatus: payment.Status,
+			TotalAmount:   cart.AmountTotal,
+			Currency:      cart.Currency,
+		},
+	}
+	if payment.Status.Paid() {
+		hook.Data.Discount = cart.AmountDiscount + payment.AmountDiscount
+	}
+	return hook
+}
+
+// outOfStock moves a paid cart that could not get its keys to the out_of_stock
+// status and reports it to the admin, the buyer gets the purchase once the
+// admin has added keys and marked the cart as paid.
+func outOfStock(ctx context.Context, cart *models.Cart, payment *litepay.Payment, update *models.Cart, reason error) (bool, error) {
+	db := queries.DB()
+	log := logging.New()
+
+	payment.Status = litepay.OUT_OF_STOCK
+	update.PaymentStatus = litepay.OUT_OF_STOCK
+	stored, err := db.OutOfStockCart(ctx, update)
+	if err != nil || !stored {
+		return false, err
+	}
+
+	if payment.Subscription != nil {
+		if err := db.AddSubscription(ctx, cart, payment.Subscription); err != nil {
+			log.ErrorStack(err)
+		}
+	}
+
+	log.Warn().Err(reason).Str("cart_id", cart.ID).Msg("paid cart is out of stock")
+	if err := mailer.SendOutOfStockLetter(cart.ID); err != nil {
+		log.ErrorStack(err)
+	}
+
+	return true, nil
+}
@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+
 	"github.com/vuisme/litecart/internal/mailer"
+	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
 	"github.com/vuisme/litecart/pkg/logging"
 	"github.com/vuisme/litecart/pkg/webutil"
 )
@@ -36,3 +43,206 @@ func CartSendMail(c *fiber.Ctx) error {
 
 	return webutil.Response(c, fiber.StatusOK, "Mail sended", nil)
 }
+
+// CartSendPaymentLink sends the prepayment letter again, its link lets the
+// buyer start a new payment of the cart.
+// [post] /api/_/carts/:cart_id/payment-link
+func CartSendPaymentLink(c *fiber.Ctx) error {
+	cartID := c.Params("cart_id")
+	db := queries.DB()
+	log := logging.New()
+
+	cart, err := db.Cart(c.Context(), cartID)
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if !cart.Payable() {
+		return webutil.StatusBadRequest(c, "Only unpaid carts have a payment link")
+	}
+	if cart.Email == "" {
+		return webutil.StatusBadRequest(c, "Cart has no email")
+	}
+
+	if err := mailer.SendPrepaymentLetter(cart.Email, cart.AmountTotal, cart.Currency, cart.ID); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Payment link sended", nil)
+}
+
+// CartPaid is ...
+// [post] /api/_/carts/:cart_id/paid
+func CartPaid(c *fiber.Ctx) error {
+	cartID := c.Params("cart_id")
+	db := queries.DB()
+	log := logging.New()
+
+	cart, err := db.Cart(c.Context(), cartID)
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// a cart that is out of stock was paid already and is delivered once keys were added
+	if cart.PaymentStatus != litepay.AWAITING_PAYMENT && cart.PaymentStatus != litepay.OUT_OF_STOCK {
+		return webutil.StatusBadRequest(c, "Only carts awaiting payment or out of stock can be marked as paid")
+	}
+
+	paid, err := db.PayCart(c.Context(), &models.Cart{
+		Core: models.Core{
+			ID: cart.ID,
+		},
+		PaymentStatus: litepay.PAID,
+		AmountPaid:    cart.AmountPaid,
+	})
+	if errors.Is(err, errors.ErrNotEnoughKeys) {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if !paid {
+		return webutil.StatusBadRequest(c, "Cart is already paid")
+	}
+
+	// send email
+	if err := mailer.SendCartLetter(cart.ID); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// send hook
+	hook := &webhook.Payment{
+		Event:     webhook.PAYMENT_SUCCESS,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			CartID:        cart.ID,
+			PaymentSystem: cart.PaymentSystem,
+			PaymentStatus: litepay.PAID,
+			TotalAmount:   cart.AmountTotal,
+			Currency:      cart.Currency,
+		},
+	}
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart paid", nil)
+}
+
+// CartRefund is ...
+// [post] /api/_/carts/:cart_id/refund
+func CartRefund(c *fiber.Ctx) error {
+	cartID := c.Params("cart_id")
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.CartRefund)
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+	}
+
+	if err := request.Validate(); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	cart, err := db.Cart(c.Context(), cartID)
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if !cart.PaymentStatus.Paid() && cart.PaymentStatus != litepay.PARTIALLY_REFUNDED && cart.PaymentStatus != litepay.OUT_OF_STOCK {
+		return webutil.StatusBadRequest(c, "Only paid carts can be refunded")
+	}
+
+	// a discount granted by the payment system lowers the amount that was paid
+	paid := cart.AmountTotal
+	if cart.AmountPaid > 0 {
+		paid = cart.AmountPaid
+	}
+	remaining := paid - cart.AmountRefunded
+	amount := request.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		return webutil.StatusBadRequest(c, "Refund amount exceeds the paid amount")
+	}
+
+	provider, ok := litepay.Lookup(cart.PaymentSystem)
+	if !ok {
+		return webutil.StatusBadRequest(c, litepay.ErrRefundUnsupported.Error())
+	}
+
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	refund, err := provider.New(litepay.New("", "", ""), setting.Settings).Refund(&litepay.Payment{
+		PaymentSystem: cart.PaymentSystem,
+		MerchantID:    cart.PaymentID,
+		CartID:        cart.ID,
+		AmountTotal:   remaining,
+		Currency:      cart.Currency,
+	}, amount)
+	if err != nil {
+		if err == litepay.ErrRefundUnsupported {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	refunded, err := db.RefundCart(c.Context(), cart.ID, cart.AmountRefunded, refund.AmountTotal, refund.Status)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// a refund was stored since the cart was read, by the notification of the
+	// payment system or by another request
+	if !refunded {
+		return webutil.Response(c, fiber.StatusConflict, "Cart was refunded in the meantime, check the refunds in the payment system", refund)
+	}
+
+	// send hook
+	hook := &webhook.Payment{
+		Event:     webhook.PAYMENT_REFUND,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem: cart.PaymentSystem,
+			PaymentStatus: refund.Status,
+			CartID:        cart.ID,
+			TotalAmount:   cart.AmountTotal,
+			RefundAmount:  refund.AmountTotal,
+			Currency:      cart.Currency,
+		},
+	}
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart refunded", refund)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/logging"
+	"github.com/vuisme/litecart/pkg/webutil"
+)
+
+// Coupons is ...
+// [get] /api/_/coupons
+func Coupons(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	coupons, err := db.Coupons(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupons", coupons)
+}
+
+// AddCoupon is ...
+// [post] /api/_/coupons
+func AddCoupon(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := &models.Coupon{Active: true}
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if db.IsCouponCode(c.Context(), request.Code, "") {
+		return webutil.StatusBadRequest(c, "Coupon code already exists")
+	}
+
+	coupon, err := db.AddCoupon(c.Context(), request)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupon added", coupon)
+}
+
+// Coupon is ...
+// [get] /api/_/coupons/:coupon_id
+func Coupon(c *fiber.Ctx) error {
+	couponID := c.Params("coupon_id")
+	db := queries.DB()
+	log := logging.New()
+
+	coupon, err := db.Coupon(c.Context(), couponID)
+	if err != nil {
+		if err == errors.ErrCouponNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupon info", coupon)
+}
+
+// UpdateCoupon is ...
+// [patch] /api/_/coupons/:coupon_id
+func UpdateCoupon(c *fiber.Ctx) error {
+	couponID := c.Params("coupon_id")
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.Coupon)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = couponID
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if db.IsCouponCode(c.Context(), request.Code, couponID) {
+		return webutil.StatusBadRequest(c, "Coupon code already exists")
+	}
+
+	if err := db.UpdateCoupon(c.Context(), request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupon updated", nil)
+}
+
+// DeleteCoupon is ...
+// [delete] /api/_/coupons/:coupon_id
+func DeleteCoupon(c *fiber.Ctx) error {
+	couponID := c.Params("coupon_id")
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteCoupon(c.Context(), couponID); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupon deleted", nil)
+}
+
+// UpdateCouponActive is ...
+// [patch] /api/_/coupons/:coupon_id/active
+func UpdateCouponActive(c *fiber.Ctx) error {
+	couponID := c.Params("coupon_id")
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.UpdateCouponActive(c.Context(), couponID); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Coupon active updated", nil)
+}
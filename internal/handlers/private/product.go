@@ -42,6 +42,10 @@ func AddProduct(c *fiber.Ctx) error {
 		return webutil.StatusBadRequest(c, err.Error())
 	}
 
+	if err := request.NormalizePricing(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
 	product, err := db.AddProduct(c.Context(), request)
 	if err != nil {
 		log.ErrorStack(err)
@@ -81,6 +85,10 @@ func UpdateProduct(c *fiber.Ctx) error {
 		return webutil.StatusBadRequest(c, err.Error())
 	}
 
+	if err := request.NormalizePricing(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
 	if err := db.UpdateProduct(c.Context(), request); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
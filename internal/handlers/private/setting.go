@@ -4,14 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/vuisme/litecart/internal/mailer"
 	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/internal/queries"
 	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
 	"github.com/vuisme/litecart/pkg/logging"
 	"github.com/vuisme/litecart/pkg/update"
 	"github.com/vuisme/litecart/pkg/webutil"
@@ -65,6 +70,28 @@ func Version(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Version", version)
 }
 
+// Sandbox is ...
+// [get] /api/_/sandbox
+func Sandbox(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	sandbox := []litepay.PaymentSystem{}
+	for _, provider := range litepay.Providers() {
+		setting, err := db.GetPaymentProvider(c.Context(), provider)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		if setting.Active && setting.Sandbox() {
+			sandbox = append(sandbox, provider.Name)
+		}
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Sandbox", sandbox)
+}
+
 // GetSetting is ...
 // [get] /api/_/settings/:setting_key
 func GetSetting(c *fiber.Ctx) error {
@@ -88,8 +115,12 @@ func GetSetting(c *fiber.Ctx) error {
 		section, err = db.GetSettingByGroup(c.Context(), &models.JWT{})
 	case "webhook":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Webhook{})
+	case "reconcile":
+		section, err = db.GetSettingByGroup(c.Context(), &models.Reconcile{})
 	case "payment":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Payment{})
+	case "tax":
+		section, err = db.GetSettingByGroup(c.Context(), &models.Tax{})
 	case "stripe":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Stripe{})
 	case "paypal":
@@ -99,7 +130,19 @@ func GetSetting(c *fiber.Ctx) error {
 	case "mail":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Mail{})
 	default:
-		section, err = db.GetSettingByKey(c.Context(), settingKey)
+		if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+			section, err = paymentProviderSetting(c.Context(), db, provider)
+			break
+		}
+
+		var settings map[string]models.SettingName
+		settings, err = db.GetSettingByKey(c.Context(), settingKey)
+		// a secret of a payment system read by its key is masked as well
+		if setting, ok := settings[settingKey]; ok && secretSetting(settingKey) {
+			setting.Value = maskSecret(fmt.Sprint(setting.Value))
+			settings[settingKey] = setting
+		}
+		section = settings
 	}
 
 	if err != nil {
@@ -109,6 +152,16 @@ func GetSetting(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+
+	// the secrets of the payment systems with a settings group are not sent back
+	if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+		if fieldMap := db.GroupFieldMap(section); fieldMap != nil {
+			settings := groupSettings(provider, fieldMap)
+			maskSecrets(provider, settings)
+			setGroupSettings(provider, fieldMap, settings)
+		}
+	}
+
 	return webutil.Response(c, fiber.StatusOK, "Setting", section)
 }
 
@@ -133,6 +186,8 @@ func UpdateSetting(c *fiber.Ctx) error {
 		request = &models.Social{}
 	case "payment":
 		request = &models.Payment{}
+	case "tax":
+		request = &models.Tax{}
 	case "stripe":
 		request = &models.Stripe{}
 	case "paypal":
@@ -141,9 +196,14 @@ func UpdateSetting(c *fiber.Ctx) error {
 		request = &models.Spectrocoin{}
 	case "webhook":
 		request = &models.Webhook{}
+	case "reconcile":
+		request = &models.Reconcile{}
 	case "mail":
 		request = &models.Mail{}
 	default:
+		if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+			return updatePaymentProviderSetting(c, db, provider)
+		}
 		request = &models.SettingName{}
 	}
 
@@ -153,6 +213,37 @@ func UpdateSetting(c *fiber.Ctx) error {
 		return webutil.StatusBadRequest(c, err.Error())
 	}
 
+	// the form of a payment system sends its masked secrets back unchanged
+	if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+		stored, err := db.GetPaymentProvider(c.Context(), provider)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		fieldMap := db.GroupFieldMap(request)
+		settings := groupSettings(provider, fieldMap)
+		keepSecrets(provider, settings, stored.Settings)
+		if err := requiredSettings(provider, settings); err != nil {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		setGroupSettings(provider, fieldMap, settings)
+	}
+
+	// a wrong tax zone would charge buyers a wrong amount
+	if tax, ok := request.(*models.Tax); ok {
+		if err := tax.Validate(); err != nil {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+	}
+
+	// a zero cart ttl would cancel every cart on the next reconciliation
+	if reconcile, ok := request.(*models.Reconcile); ok {
+		if err := reconcile.Validate(); err != nil {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+	}
+
 	// Handle the password update separately if that's the case
 	if settingKey == "password" {
 		password := request.(*models.Password)
@@ -183,6 +274,154 @@ func UpdateSetting(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Setting group updated", nil)
 }
 
+// paymentProviderSetting returns the settings of a payment system that has no
+// dedicated settings group, in the same flat form as the groups.
+func paymentProviderSetting(ctx context.Context, db *queries.Base, provider litepay.Provider) (map[string]any, error) {
+	setting, err := db.GetPaymentProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	maskSecrets(provider, setting.Settings)
+	section := map[string]any{"active": setting.Active}
+	for key, value := range setting.Settings {
+		section[key] = value
+	}
+
+	return section, nil
+}
+
+// updatePaymentProviderSetting stores the settings of a payment system that has no
+// dedicated settings group.
+func updatePaymentProviderSetting(c *fiber.Ctx, db *queries.Base, provider litepay.Provider) error {
+	log := logging.New()
+	request := map[string]any{}
+
+	if err := c.BodyParser(&request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	stored := litepay.Settings{}
+	for key, value := range setting.Settings {
+		stored[key] = value
+	}
+
+	if active, ok := request["active"].(bool); ok {
+		setting.Active = active
+	}
+	for _, field := range provider.Settings {
+		value, ok := request[field.Key]
+		if !ok {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			setting.Settings[field.Key] = value
+		case bool:
+			setting.Settings[field.Key] = strconv.FormatBool(value)
+		case float64:
+			setting.Settings[field.Key] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			return webutil.StatusBadRequest(c, fmt.Sprintf("%s: must be a string.", field.Key))
+		}
+	}
+
+	keepSecrets(provider, setting.Settings, stored)
+	if err := requiredSettings(provider, setting.Settings); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.UpdatePaymentProvider(c.Context(), provider, setting); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Setting group updated", nil)
+}
+
+// maskSecret hides a secret setting. The last characters are kept, so that
+// the admin can tell which secret is stored, and the mask has the length of
+// the secret, so that it passes the length rules of the settings forms.
+func maskSecret(value string) string {
+	runes := []rune(value)
+	visible := 4
+	if len(runes) <= 4*visible {
+		visible = 0
+	}
+	return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:])
+}
+
+// secretSetting reports whether the stored setting key is a secret of a payment system.
+func secretSetting(key string) bool {
+	for _, provider := range litepay.Providers() {
+		for _, field := range provider.Settings {
+			if field.Secret && key == string(provider.Name)+"_"+field.Key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskSecrets masks the secret settings of the payment system.
+func maskSecrets(provider litepay.Provider, settings litepay.Settings) {
+	for _, field := range provider.Settings {
+		if field.Secret && settings[field.Key] != "" {
+			settings[field.Key] = maskSecret(settings[field.Key])
+		}
+	}
+}
+
+// keepSecrets replaces the masked secrets sent back by the settings form
+// with the stored secrets.
+func keepSecrets(provider litepay.Provider, settings, stored litepay.Settings) {
+	for _, field := range provider.Settings {
+		if field.Secret && stored[field.Key] != "" && settings[field.Key] == maskSecret(stored[field.Key]) {
+			settings[field.Key] = stored[field.Key]
+		}
+	}
+}
+
+// requiredSettings returns the errors of the required settings of the payment
+// system that are empty.
+func requiredSettings(provider litepay.Provider, settings litepay.Settings) error {
+	errs := validation.Errors{}
+	for _, field := range provider.Settings {
+		if field.Required {
+			errs[field.Key] = validation.Validate(strings.TrimSpace(settings[field.Key]), validation.Required)
+		}
+	}
+	return errs.Filter()
+}
+
+// groupSettings returns the text settings of a payment system that has a
+// settings group, keyed like litepay.Settings.
+func groupSettings(provider litepay.Provider, fieldMap map[string]any) litepay.Settings {
+	settings := litepay.Settings{}
+	for _, field := range provider.Settings {
+		if ptr, ok := fieldMap[string(provider.Name)+"_"+field.Key].(*string); ok {
+			settings[field.Key] = *ptr
+		}
+	}
+	return settings
+}
+
+// setGroupSettings writes the text settings back into the settings group.
+func setGroupSettings(provider litepay.Provider, fieldMap map[string]any, settings litepay.Settings) {
+	for _, field := range provider.Settings {
+		if ptr, ok := fieldMap[string(provider.Name)+"_"+field.Key].(*string); ok {
+			*ptr = settings[field.Key]
+		}
+	}
+}
+
 // TestLetter is ...
 // [get] /api/_/test/letter/:letter_name
 func TestLetter(c *fiber.Ctx) error {
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/logging"
+	"github.com/vuisme/litecart/pkg/webutil"
+)
+
+// Subscriptions is ...
+// [get] /api/_/subscriptions
+func Subscriptions(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	subscriptions, err := db.Subscriptions(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Subscriptions", subscriptions)
+}
+
+// CancelSubscription stops the subscription in the payment system at once,
+// the buyer loses access to it.
+// [post] /api/_/subscriptions/:subscription_id/cancel
+func CancelSubscription(c *fiber.Ctx) error {
+	subscriptionID := c.Params("subscription_id")
+	db := queries.DB()
+	log := logging.New()
+
+	subscription, err := db.Subscription(c.Context(), subscriptionID)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if !subscription.Status.Active() {
+		return webutil.StatusBadRequest(c, "Subscription is not active")
+	}
+
+	provider, ok := litepay.Lookup(subscription.PaymentSystem)
+	if !ok {
+		return webutil.StatusBadRequest(c, "Payment system is not registered")
+	}
+
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	subscriber, ok := provider.New(litepay.New("", "", ""), setting.Settings).(litepay.Subscriber)
+	if !ok {
+		return webutil.StatusBadRequest(c, "Subscriptions are not supported by this payment system")
+	}
+
+	canceled, err := subscriber.CancelSubscription(subscription.SubscriptionID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	subscription.Status = canceled.Status
+	subscription.CurrentPeriodEnd = canceled.CurrentPeriodEnd
+	subscription.CancelAtPeriodEnd = false
+	if err := db.UpdateSubscription(c.Context(), subscription); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// send hook
+	hook := &webhook.Payment{
+		Event:     webhook.SUBSCRIPTION_REVOKE,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem:      subscription.PaymentSystem,
+			CartID:             subscription.CartID,
+			SubscriptionID:     subscription.SubscriptionID,
+			SubscriptionStatus: subscription.Status,
+		},
+	}
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Subscription canceled", subscription)
+}
@@ -1,15 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/vuisme/litecart/internal/checkout"
 	"github.com/vuisme/litecart/internal/mailer"
 	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/internal/queries"
 	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
 	"github.com/vuisme/litecart/pkg/litepay"
 	"github.com/vuisme/litecart/pkg/logging"
 	"github.com/vuisme/litecart/pkg/security"
@@ -30,6 +38,16 @@ func PaymentList(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Payment list", paymentList)
 }
 
+// freeCartLimit is the number of free carts an email can get within freeCartPeriod.
+const (
+	freeCartLimit  = 5
+	freeCartPeriod = 24 * time.Hour
+)
+
+// maxChosenAmount is the highest unit price in minor units a buyer can choose
+// for a pay-what-you-want product.
+const maxChosenAmount = 100000000
+
 // Payment is ...
 // [post] /cart/payment
 func Payment(c *fiber.Ctx) error {
@@ -42,6 +60,19 @@ func Payment(c *fiber.Ctx) error {
 		return webutil.StatusBadRequest(c, err.Error())
 	}
 
+	if err := payment.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err)
+	}
+
+	unavailable, err := checkStock(c.Context(), payment.Products)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if unavailable != nil {
+		return webutil.StatusBadRequest(c, unavailable)
+	}
+
 	setting, err := db.GetSettingByKey(c.Context(), "domain", "currency")
 	if err != nil {
 		log.ErrorStack(err)
@@ -50,12 +81,186 @@ func Payment(c *fiber.Ctx) error {
 	domain := setting["domain"].Value.(string)
 	currency := setting["currency"].Value.(string)
 
-	products, err := db.ListProducts(c.Context(), false, payment.Products...)
+	priced, reason, err := priceCart(c.Context(), payment, domain, currency, "")
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if reason != "" {
+		return webutil.StatusBadRequest(c, reason)
+	}
+	items, amountDiscount, tax := priced.Items, priced.AmountDiscount, priced.Tax
+
+	cart := litepay.Cart{
+		ID:       security.RandomString(),
+		Email:    payment.Email,
+		Currency: currency,
+		Items:    items,
+		Locale:   webutil.Language(c),
+	}
+	amountTotal := cart.AmountTotal()
+
+	order := &models.Cart{
+		Core: models.Core{
+			ID: cart.ID,
+		},
+		Email:          payment.Email,
+		Cart:           priced.Lines,
+		AmountTotal:    amountTotal,
+		AmountDiscount: amountDiscount,
+		Coupon:         payment.Coupon,
+		Tax:            tax,
+		Currency:       cart.Currency,
+	}
+	if tax != nil {
+		order.AmountTax = tax.AmountTax
+	}
+
+	callbackURL := fmt.Sprintf("https://%s/cart/payment/callback", domain)
+	successURL := fmt.Sprintf("https://%s/cart/payment/success", domain)
+	cancelURL := fmt.Sprintf("https://%s/cart/payment/cancel", domain)
+	pay := litepay.New(callbackURL, successURL, cancelURL)
+
+	// a free cart does not need a payment system
+	if amountTotal == 0 {
+		return freePayment(c, order, cart, successURL)
+	}
+
+	paymentSystem := payment.Provider
+	unavailableProvider := validation.Errors{
+		"provider": validation.NewError("validation_provider_unavailable", "payment system is not available"),
+	}
+	provider, ok := litepay.Lookup(paymentSystem)
+	if !ok {
+		return webutil.StatusBadRequest(c, unavailableProvider)
+	}
+
+	providerSetting, err := db.GetPaymentProvider(c.Context(), provider)
 	if err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	if !providerSetting.Active {
+		return webutil.StatusBadRequest(c, unavailableProvider)
+	}
+	if !provider.SupportCurrency(cart.Currency) {
+		return webutil.StatusBadRequest(c, "Payment system does not support the currency of the cart")
+	}
+	if len(cart.Intervals()) > 0 && !provider.Recurring {
+		return webutil.StatusBadRequest(c, "Subscriptions can not be paid with this payment system")
+	}
+
+	response, err := provider.New(pay, providerSetting.Settings).Pay(cart)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	paymentURL := response.URL
+	paymentStatus := litepay.NEW
+	if response.Status == litepay.AWAITING_PAYMENT {
+		paymentStatus = response.Status
+	}
+
+	order.PaymentID = response.MerchantID
+	order.PaymentStatus = paymentStatus
+	order.PaymentSystem = paymentSystem
+	if err := db.AddCart(c.Context(), order); err != nil {
+		// another checkout took the last use of the coupon since it was checked
+		if err == errors.ErrCouponLimit {
+			return webutil.StatusBadRequest(c, "Coupon usage limit reached")
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// send email
+	if paymentStatus == litepay.AWAITING_PAYMENT {
+		if err := mailer.SendInstructionsLetter(payment.Email, amountTotal, cart.Currency, cart.ID, response.Instructions); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+	} else if err := mailer.SendPrepaymentLetter(payment.Email, amountTotal, cart.Currency, cart.ID); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// send hook
+	hook := &webhook.Payment{
+		Event:     webhook.PAYMENT_INITIATION,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem: paymentSystem,
+			PaymentStatus: paymentStatus,
+			CartID:        cart.ID,
+			TotalAmount:   amountTotal,
+			Currency:      cart.Currency,
+			CartItems:     items,
+		},
+	}
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+}
+
+// checkStock returns the errors of the cart products that can not be sold in
+// the requested quantity, keyed by their position in the cart, or nil.
+func checkStock(ctx context.Context, products []models.CartProduct) (validation.Errors, error) {
+	db := queries.DB()
+
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ProductID
+	}
+
+	stock, err := db.ProductStock(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := validation.Errors{}
+	for i, product := range products {
+		units, ok := stock[product.ProductID]
+		switch {
+		case !ok:
+			errs[strconv.Itoa(i)] = validation.Errors{"id": validation.NewError("validation_product_unavailable", "product is not available")}
+		case units == 0:
+			errs[strconv.Itoa(i)] = validation.Errors{"id": validation.NewError("validation_product_sold_out", "product is sold out")}
+		case units > 0 && product.Quantity > units:
+			errs[strconv.Itoa(i)] = validation.Errors{"quantity": validation.NewError("validation_product_stock", "only {{.units}} left").SetParams(map[string]any{"units": units})}
+		}
+	}
+	if len(errs) > 0 {
+		return validation.Errors{"products": errs}, nil
+	}
+
+	return nil, nil
+}
+
+// pricedCart is the cart priced by priceCart.
+type pricedCart struct {
+	Lines          []models.CartProduct // the lines of the cart with the snapshot of the products
+	Items          []litepay.Item
+	AmountDiscount int
+	Tax            *models.CartTax
+}
+
+// priceCart builds the lines of the cart from the current products, then
+// applies the coupon and the tax. It returns the reason for the buyer why the
+// cart can not be paid, or an empty string. A stored cart is priced again when
+// the buyer pays it with a new payment session, cartID is its ID and is empty
+// for a new cart.
+func priceCart(ctx context.Context, payment *models.CartPayment, domain, currency, cartID string) (*pricedCart, string, error) {
+	db := queries.DB()
+
+	products, err := db.ListProducts(ctx, false, payment.Products...)
+	if err != nil {
+		return nil, "", err
+	}
 
+	lines := make([]models.CartProduct, len(products.Products))
 	items := make([]litepay.Item, len(products.Products))
 	for i, product := range products.Products {
 		images := []string{}
@@ -65,199 +270,538 @@ func Payment(c *fiber.Ctx) error {
 		}
 
 		quantity := 1
+		var chosen *int
 		for _, cartProduct := range payment.Products {
 			if cartProduct.ProductID == product.ID {
 				quantity = cartProduct.Quantity
+				chosen = cartProduct.Amount
+			}
+		}
+
+		unitAmount := product.Price(chosen)
+		if product.PayWhatYouWant {
+			if unitAmount < product.MinAmount {
+				return nil, fmt.Sprintf("Price of %s must be at least %s", product.Name, litepay.FormatPrice(product.MinAmount, currency)), nil
+			}
+			if unitAmount > maxChosenAmount {
+				return nil, fmt.Sprintf("Price of %s is too high", product.Name), nil
 			}
 		}
 
+		lines[i] = models.CartProduct{
+			ProductID:   product.ID,
+			Quantity:    quantity,
+			Name:        product.Name,
+			Slug:        product.Slug,
+			UnitAmount:  unitAmount,
+			Currency:    currency,
+			DigitalType: product.Digital.Type,
+		}
+		if product.PayWhatYouWant {
+			lines[i].Amount = &unitAmount
+		}
+
 		items[i] = litepay.Item{
 			PriceData: litepay.Price{
-				UnitAmount: product.Amount,
+				UnitAmount: unitAmount,
 				Product: litepay.Product{
 					Name:   product.Name,
 					Images: images,
 				},
+				Recurring: product.Recurring(),
 			},
 			Quantity: quantity,
 		}
 
-		if product.Description != "" {
-			items[i].PriceData.Product.Description = product.Description
+		// the description is the HTML of the product page, payment pages show the plain brief
+		if product.Brief != "" {
+			items[i].PriceData.Product.Description = product.Brief
 		}
 	}
 
-	cart := litepay.Cart{
-		ID:       security.RandomString(),
-		Currency: currency,
-		Items:    items,
+	var amountDiscount int
+	if payment.Coupon != "" {
+		coupon, err := db.CouponByCode(ctx, strings.TrimSpace(payment.Coupon))
+		if err != nil {
+			if err == errors.ErrCouponNotFound {
+				return nil, "Coupon not found", nil
+			}
+			return nil, "", err
+		}
+
+		reason, err := checkCoupon(ctx, coupon, payment.Email, cartID)
+		if err != nil {
+			return nil, "", err
+		}
+		if reason != "" {
+			return nil, reason, nil
+		}
+
+		// subscriptions are not discounted, the coupon would lower every renewal
+		eligible := make([]bool, len(items))
+		var eligibleAmount int
+		for i, product := range products.Products {
+			amount := items[i].PriceData.UnitAmount * items[i].Quantity
+			if amount > 0 && items[i].PriceData.Recurring == nil && coupon.AppliesTo(product.ID) {
+				eligible[i] = true
+				eligibleAmount += amount
+			}
+		}
+		if eligibleAmount == 0 {
+			return nil, "Coupon does not apply to the products in the cart", nil
+		}
+
+		amountDiscount = coupon.Discount(eligibleAmount)
+		items = litepay.DiscountItems(items, eligible, amountDiscount)
+		payment.Coupon = coupon.Code
 	}
 
-	callbackURL := fmt.Sprintf("https://%s/cart/payment/callback", domain)
-	successURL := fmt.Sprintf("https://%s/cart/payment/success", domain)
-	cancelURL := fmt.Sprintf("https://%s/cart/payment/cancel", domain)
-	pay := litepay.New(callbackURL, successURL, cancelURL)
+	taxSetting, err := queries.GetSettingByGroup[models.Tax](ctx, db)
+	if err != nil {
+		return nil, "", err
+	}
 
-	paymentURL := fmt.Sprintf("https://%s/cart", domain)
-	paymentSystem := payment.Provider
-	switch paymentSystem {
-	case litepay.STRIPE:
-		setting, err := queries.GetSettingByGroup[models.Stripe](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+	var tax *models.CartTax
+	if taxSetting.Active {
+		if err := validation.Validate(payment.Country, validation.Required, is.CountryCode2); err != nil {
+			return nil, "Country is required", nil
 		}
 
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+		if payment.VatID != "" {
+			vatID, ok := models.NormalizeVatID(payment.VatID, payment.Country)
+			if !ok {
+				return nil, "VAT ID is not valid", nil
+			}
+			payment.VatID = vatID
 		}
-		session := pay.Stripe(setting.SecretKey)
-		response, err := session.Pay(cart)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+
+		tax = applyTax(taxSetting, payment, items)
+	}
+
+	// a subscription bills all its recurring products at once
+	if len(litepay.Cart{Items: items}.Intervals()) > 1 {
+		return nil, "Products billed at different intervals can not be bought together", nil
+	}
+
+	return &pricedCart{
+		Lines:          lines,
+		Items:          items,
+		AmountDiscount: amountDiscount,
+		Tax:            tax,
+	}, "", nil
+}
+
+// freePayment completes a cart whose total is 0 without a payment system.
+// Free carts are limited per email, so that free key pools are not drained.
+func freePayment(c *fiber.Ctx, order *models.Cart, cart litepay.Cart, successURL string) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if order.Email == "" {
+		return webutil.StatusBadRequest(c, "Email is required")
+	}
+
+	count, err := db.CountFreeCarts(c.Context(), order.Email, freeCartPeriod)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if count >= freeCartLimit {
+		return webutil.Response(c, fiber.StatusTooManyRequests, "Too many free orders, try again later", nil)
+	}
+
+	order.PaymentStatus = litepay.NEW
+	order.PaymentSystem = litepay.FREE
+	if err := db.AddCart(c.Context(), order); err != nil {
+		// another checkout took the last use of the coupon since it was checked
+		if err == errors.ErrCouponLimit {
+			return webutil.StatusBadRequest(c, "Coupon usage limit reached")
 		}
-		paymentURL = response.URL
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
 
-	case litepay.PAYPAL:
-		setting, err := queries.GetSettingByGroup[models.Paypal](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+	// the cart is fulfilled like a paid one, with its keys and letter
+	payment := &litepay.Payment{
+		PaymentSystem: litepay.FREE,
+		CartID:        cart.ID,
+		AmountTotal:   order.AmountTotal,
+		Currency:      cart.Currency,
+		Status:        litepay.PAID,
+	}
+	if _, err := checkout.UpdatePayment(c.Context(), order, payment); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// send hook
+	hook := checkout.PaymentHook(webhook.PAYMENT_SUCCESS, order, payment)
+	if !payment.Status.Paid() {
+		hook.Event = webhook.PAYMENT_CALLBACK
+	}
+	hook.Data.CartItems = cart.Items
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	paymentURL := fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", successURL, litepay.FREE, cart.ID)
+	return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+}
+
+// applyTax sets the tax of the buyer's country on the items and returns the
+// tax breakdown of the cart. A buyer with a VAT ID in a reverse charge zone
+// outside the shop country is not charged the tax, with inclusive prices such
+// a buyer pays the listed price.
+func applyTax(setting *models.Tax, payment *models.CartPayment, items []litepay.Item) *models.CartTax {
+	tax := &models.CartTax{
+		Country:   strings.ToUpper(payment.Country),
+		VatID:     payment.VatID,
+		Inclusive: setting.Inclusive,
+		Lines:     make([]models.TaxLine, len(items)),
+	}
+
+	if zone := setting.Zone(payment.Country); zone != nil {
+		tax.Zone = zone.Name
+		tax.Rate = zone.Rate
+		if zone.ReverseCharge && payment.VatID != "" && !strings.EqualFold(payment.Country, setting.Country) {
+			tax.ReverseCharge = true
+			tax.Rate = 0
 		}
+	}
 
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	for i, item := range items {
+		amount := item.PriceData.UnitAmount * item.Quantity
+		line := models.TaxLine{
+			Name:     item.PriceData.Product.Name,
+			Quantity: item.Quantity,
+			Net:      amount,
+			Tax:      litepay.LineTax(amount, tax.Rate, setting.Inclusive),
+			Gross:    amount,
 		}
-		session := pay.Paypal(setting.ClientID, setting.SecretKey)
-		response, err := session.Pay(cart)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+		if setting.Inclusive {
+			line.Net -= line.Tax
+		} else {
+			line.Gross += line.Tax
+		}
+
+		if line.Tax > 0 {
+			items[i].Tax = &litepay.Tax{
+				Name:      tax.Zone,
+				Rate:      tax.Rate,
+				Amount:    line.Tax,
+				Inclusive: setting.Inclusive,
+			}
 		}
-		paymentURL = response.URL
 
-	case litepay.SPECTROCOIN:
-		setting, err := queries.GetSettingByGroup[models.Spectrocoin](c.Context(), db)
+		tax.Lines[i] = line
+		tax.AmountNet += line.Net
+		tax.AmountTax += line.Tax
+		tax.AmountGross += line.Gross
+	}
+
+	return tax
+}
+
+// checkCoupon returns the reason for the buyer why the coupon can not be used
+// by the email now, or an empty string. Pending carts count as uses, so that a
+// limited coupon is not used by several checkouts at once. The stored cart
+// with cartID does not count its own use.
+func checkCoupon(ctx context.Context, coupon *models.Coupon, email, cartID string) (string, error) {
+	db := queries.DB()
+
+	if err := coupon.Available(time.Now()); err != nil {
+		return err.Error(), nil
+	}
+
+	var own int
+	if cartID != "" {
+		used, err := db.CartUsesCoupon(ctx, cartID, coupon.Code)
 		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+			return "", err
+		}
+		if used {
+			own = 1
 		}
+	}
 
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	if coupon.MaxUses > 0 && coupon.Uses-own >= coupon.MaxUses {
+		return "Coupon usage limit reached", nil
+	}
+
+	if coupon.MaxUsesEmail > 0 {
+		if email == "" {
+			return "Email is required for this coupon", nil
 		}
-		session := pay.Spectrocoin(setting.MerchantID, setting.ProjectID, setting.PrivateKey)
-		response, err := session.Pay(cart)
+
+		uses, err := db.CouponEmailUses(ctx, coupon.Code, email)
 		if err != nil {
+			return "", err
+		}
+		if uses-own >= coupon.MaxUsesEmail {
+			return "Coupon usage limit reached for this email", nil
+		}
+	}
+
+	return "", nil
+}
+
+// PaymentCallback is ...
+// [post] /cart/payment/callback
+func PaymentCallback(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	paymentSystem := litepay.PaymentSystem(c.Query("payment_system"))
+
+	if paymentSystem == "" && c.Get("Stripe-Signature") != "" {
+		paymentSystem = litepay.STRIPE
+	}
+	if paymentSystem == "" && c.Get(litepay.BTCPaySignatureHeader) != "" {
+		paymentSystem = litepay.BTCPAY
+	}
+
+	provider, ok := litepay.Lookup(paymentSystem)
+	if !ok || provider.Callback == nil {
+		return webutil.StatusNotFound(c)
+	}
+
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if !setting.Active {
+		return webutil.StatusNotFound(c)
+	}
+
+	header := http.Header{}
+	for key, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	payment, err := provider.Callback(setting.Settings, header, c.Body())
+	if err != nil {
+		// the payment system sends the notification again after an error status
+		if errors.Is(err, litepay.ErrProviderUnavailable) {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
 		}
-		paymentURL = response.URL
+		log.Warn().Err(err).Str("payment_system", string(paymentSystem)).Msg("rejected payment callback")
+		return webutil.StatusBadRequest(c, err.Error())
 	}
 
-	var amountTotal int
-	for _, s := range cart.Items {
-		amountTotal += s.PriceData.UnitAmount * s.Quantity
+	// the notification does not concern a payment
+	if payment == nil {
+		return c.Status(fiber.StatusOK).SendString("*ok*")
 	}
 
-	db.AddCart(c.Context(), &models.Cart{
-		Core: models.Core{
-			ID: cart.ID,
-		},
-		Email:         payment.Email,
-		Cart:          payment.Products,
-		AmountTotal:   amountTotal,
-		Currency:      cart.Currency,
-		PaymentStatus: litepay.NEW,
-		PaymentSystem: paymentSystem,
-	})
+	// renewals and changes of a subscription do not concern the payment of the cart
+	if payment.Subscription != nil && payment.CartID == "" {
+		return subscriptionCallback(c, setting, payment)
+	}
 
-	// send email
-	if err := mailer.SendPrepaymentLetter(payment.Email, fmt.Sprintf("%.2f %s", float64(amountTotal)/100, cart.Currency), paymentURL); err != nil {
+	var cart *models.Cart
+	if payment.CartID != "" {
+		cart, err = db.Cart(c.Context(), payment.CartID)
+	} else {
+		cart, err = db.CartByPaymentID(c.Context(), payment.MerchantID)
+	}
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			log.Warn().Str("payment_system", string(paymentSystem)).Str("cart_id", payment.CartID).Msg("payment callback for unknown cart")
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	// send hook
+	if cartID := c.Query("cart_id"); cartID != "" && cartID != cart.ID {
+		log.Warn().Str("cart_id", cartID).Str("order_id", cart.ID).Msg("rejected payment callback: order does not match the cart")
+		return webutil.StatusBadRequest(c, "Callback does not match the cart")
+	}
+
+	payment.Status = setting.SandboxStatus(payment.Status)
 	hook := &webhook.Payment{
-		Event:     webhook.PAYMENT_INITIATION,
+		Event:     webhook.PAYMENT_CALLBACK,
 		TimeStamp: time.Now().Unix(),
 		Data: webhook.Data{
 			PaymentSystem: paymentSystem,
-			PaymentStatus: litepay.NEW,
+			PaymentStatus: payment.Status,
 			CartID:        cart.ID,
-			TotalAmount:   amountTotal,
-			Currency:      cart.Currency,
-			CartItems:     items,
 		},
 	}
+
+	switch payment.Status {
+	case litepay.REFUNDED, litepay.PARTIALLY_REFUNDED:
+		amount := payment.AmountRefunded - cart.AmountRefunded
+		if amount <= 0 {
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
+
+		refunded, err := db.RefundCart(c.Context(), cart.ID, cart.AmountRefunded, amount, payment.Status)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		// another refund was stored since the cart was read, the payment
+		// system sends the notification again and it is counted from the new total
+		if !refunded {
+			return webutil.Response(c, fiber.StatusConflict, "Cart was refunded in the meantime", nil)
+		}
+
+		hook.Event = webhook.PAYMENT_REFUND
+		hook.Data.TotalAmount = cart.AmountTotal
+		hook.Data.RefundAmount = amount
+		hook.Data.Currency = cart.Currency
+
+	default:
+		if cart.PaymentStatus.Paid() || cart.PaymentStatus == payment.Status {
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
+
+		// a session replaced by the payment link was paid, the cart waits for
+		// its new session and the payment is reported to be refunded
+		if payment.Status.Paid() && replacedSession(provider, setting, cart, payment) {
+			log.Warn().
+				Str("cart_id", cart.ID).
+				Str("payment_system", string(paymentSystem)).
+				Str("payment_id", payment.MerchantID).
+				Msg("payment of a replaced session, refund it in the payment system")
+			hook.Event = webhook.PAYMENT_ERROR
+			hook.Data.TotalAmount = payment.AmountTotal
+			hook.Data.Currency = payment.Currency
+			break
+		}
+
+		changed, err := checkout.UpdatePayment(c.Context(), cart, payment)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		// the cart was completed by another notification
+		if !changed {
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
+		hook = checkout.PaymentHook(webhook.PAYMENT_CALLBACK, cart, payment)
+	}
+
+	// send hook
 	if err := webhook.SendPaymentHook(hook); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	return c.Status(fiber.StatusOK).SendString("*ok*")
 }
 
-// PaymentCallback is ...
-// [get] /cart/payment/callback
-func PaymentCallback(c *fiber.Ctx) error {
-	log := logging.New()
-	payment := &litepay.Payment{
-		CartID:        c.Query("cart_id"),
-		PaymentSystem: litepay.PaymentSystem(c.Query("payment_system")),
+// replacedSession reports whether the payment belongs to a session of the cart
+// that was replaced by a new one. Payment systems that close replaced sessions
+// identify the payment by other IDs than the session, their payments are not checked.
+func replacedSession(provider litepay.Provider, setting *models.PaymentProvider, cart *models.Cart, payment *litepay.Payment) bool {
+	if cart.PaymentID == "" || payment.MerchantID == "" {
+		return false
 	}
-
-	switch payment.PaymentSystem {
-	// case litepay.STRIPE:
-	//	return webutil.Response(c, fiber.StatusOK, "Callback", payment)
-	case litepay.SPECTROCOIN:
-		response := new(litepay.CallbackSpectrocoin)
-		if err := c.BodyParser(response); err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusBadRequest(c, err.Error())
-		}
-		payment.Status = litepay.StatusPayment(litepay.SPECTROCOIN, string(rune(response.Status)))
-		payment.MerchantID = response.MerchantApiID
-		payment.Coin = &litepay.Coin{
-			AmountTotal: response.ReceiveAmount,
-			Currency:    response.ReceiveCurrency,
-		}
+	if cart.PaymentSystem != provider.Name {
+		return true
+	}
+	if _, ok := provider.New(litepay.New("", "", ""), setting.Settings).(litepay.Expirer); ok {
+		return false
 	}
+	return payment.MerchantID != cart.PaymentID
+}
 
+// subscriptionCallback records the renewal or the change of a subscription.
+// A subscription that is not stored yet is added with its cart, its events can
+// arrive before the notification of the cart payment. The renewal is counted
+// once per invoice, its letter is sent again until it was delivered. The loss
+// of access is reported by a webhook.
+func subscriptionCallback(c *fiber.Ctx, setting *models.PaymentProvider, payment *litepay.Payment) error {
 	db := queries.DB()
-	err := db.UpdateCart(c.Context(), &models.Cart{
-		Core: models.Core{
-			ID: payment.CartID,
-		},
-		PaymentID:     payment.MerchantID,
-		PaymentStatus: payment.Status,
-		PaymentSystem: payment.PaymentSystem,
-	})
+	log := logging.New()
+	event := payment.Subscription
+	paymentSystem := payment.PaymentSystem
+
+	subscription, err := db.SubscriptionByPaymentID(c.Context(), paymentSystem, event.ID)
+	if err == errors.ErrSubscriptionNotFound && event.CartID != "" {
+		var cart *models.Cart
+		if cart, err = db.Cart(c.Context(), event.CartID); err == nil {
+			if err = db.AddSubscription(c.Context(), cart, event); err == nil {
+				subscription, err = db.SubscriptionByPaymentID(c.Context(), paymentSystem, event.ID)
+			}
+		}
+	}
 	if err != nil {
+		if err == errors.ErrSubscriptionNotFound || err == errors.ErrCartNotFound {
+			log.Warn().Str("payment_system", string(paymentSystem)).Str("subscription_id", event.ID).Msg("subscription callback for unknown subscription")
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	// send email
-	if payment.Status == litepay.PAID {
-		if err := mailer.SendCartLetter(payment.CartID); err != nil {
+	hook := &webhook.Payment{
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem:      paymentSystem,
+			CartID:             subscription.CartID,
+			SubscriptionID:     subscription.SubscriptionID,
+			SubscriptionStatus: subscription.Status,
+		},
+	}
+
+	if event.Invoice != "" {
+		renewed, err := db.RenewSubscription(c.Context(), subscription.ID, event.Invoice)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		// the renewal was delivered by a previous notification, or is being
+		// delivered by the notification that recorded the invoice
+		if !renewed && (subscription.LastInvoice != event.Invoice || subscription.RenewalDelivered) {
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
+
+		// the payment system repeats the notification until the letter is sent,
+		// the keys of the renewal are sent again
+		if err := mailer.SendRenewalLetter(subscription.ID); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+		if err := db.RenewalDelivered(c.Context(), subscription.ID, event.Invoice); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		hook.Event = webhook.SUBSCRIPTION_RENEWAL
+		hook.Data.PaymentStatus = setting.SandboxStatus(payment.Status)
+		hook.Data.TotalAmount = payment.AmountTotal
+		hook.Data.Currency = payment.Currency
+	} else {
+		active := subscription.Status.Active()
+		subscription.Status = event.Status
+		subscription.CurrentPeriodEnd = event.CurrentPeriodEnd
+		subscription.CancelAtPeriodEnd = event.CancelAtPeriodEnd
+		if err := db.UpdateSubscription(c.Context(), subscription); err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
 		}
+
+		// only the loss of access is reported
+		if !active || event.Status.Active() {
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
+
+		hook.Event = webhook.SUBSCRIPTION_REVOKE
+		hook.Data.SubscriptionStatus = event.Status
 	}
 
 	// send hook
-	hook := &webhook.Payment{
-		Event:     webhook.PAYMENT_CALLBACK,
-		TimeStamp: time.Now().Unix(),
-		Data: webhook.Data{
-			PaymentSystem: payment.PaymentSystem,
-			PaymentStatus: payment.Status,
-			CartID:        payment.CartID,
-		},
-	}
 	if err := webhook.SendPaymentHook(hook); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
@@ -290,84 +834,60 @@ func PaymentSuccess(c *fiber.Ctx) error {
 		return webutil.StatusInternalServerError(c)
 	}
 
-	if cartInfo.PaymentStatus == "paid" {
+	if cartInfo.PaymentStatus.Paid() {
 		return c.Render("success", nil, "layouts/main")
 	}
 
-	switch payment.PaymentSystem {
-	case litepay.STRIPE:
-		sessionStripe := c.Query("session")
-		setting, err := queries.GetSettingByGroup[models.Stripe](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+	provider, ok := litepay.Lookup(payment.PaymentSystem)
+	if !ok {
+		return webutil.StatusNotFound(c)
+	}
 
-		if !setting.Active {
-			return webutil.StatusNotFound(c)
-		}
-		response, err := litepay.New("", "", "").Stripe(setting.SecretKey).Checkout(payment, sessionStripe)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-		payment.MerchantID = response.MerchantID
-		payment.Status = response.Status
+	// the payment status will be delivered to the callback url
+	if provider.SessionParam == "" {
+		return c.Render("success", nil, "layouts/main")
+	}
 
-	case litepay.PAYPAL:
-		tokenPaypal := c.Query("token")
-		setting, err := queries.GetSettingByGroup[models.Paypal](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+	// a session replaced by the payment link is not checked out
+	session := c.Query(provider.SessionParam)
+	if cartInfo.PaymentSystem != provider.Name || (cartInfo.PaymentID != "" && session != cartInfo.PaymentID) {
+		return webutil.StatusBadRequest(c, "Payment session was replaced, pay the cart with its new session")
+	}
 
-		if !setting.Active {
-			return webutil.StatusNotFound(c)
-		}
-		response, err := litepay.New("", "", "").Paypal(setting.ClientID, setting.SecretKey).Checkout(payment, tokenPaypal)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-		payment.MerchantID = response.MerchantID
-		payment.Status = response.Status
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
 
-	case litepay.SPECTROCOIN:
-		fmt.Print(payment)
+	if !setting.Active {
+		return webutil.StatusNotFound(c)
 	}
 
-	err = db.UpdateCart(c.Context(), &models.Cart{
-		Core: models.Core{
-			ID: payment.CartID,
-		},
-		PaymentID:     payment.MerchantID,
-		PaymentStatus: payment.Status,
-		PaymentSystem: payment.PaymentSystem,
-	})
+	response, err := provider.New(litepay.New("", "", ""), setting.Settings).Checkout(payment, session)
 	if err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	payment.MerchantID = response.MerchantID
+	payment.Status = setting.SandboxStatus(response.Status)
 
-	// send email
-	if payment.Status == litepay.PAID {
-		if err := mailer.SendCartLetter(payment.CartID); err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+	payment.AmountTotal = response.AmountTotal
+	payment.Currency = response.Currency
+
+	changed, err := checkout.UpdatePayment(c.Context(), cartInfo, payment)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
 	}
 
-	// send hook
-	hook := &webhook.Payment{
-		Event:     webhook.PAYMENT_SUCCESS,
-		TimeStamp: time.Now().Unix(),
-		Data: webhook.Data{
-			PaymentSystem: payment.PaymentSystem,
-			PaymentStatus: payment.Status,
-			CartID:        payment.CartID,
-		},
+	// the cart was completed by another notification or a page refresh
+	if !changed {
+		return c.Render("success", nil, "layouts/main")
 	}
+
+	// send hook
+	hook := checkout.PaymentHook(webhook.PAYMENT_SUCCESS, cartInfo, payment)
 	if err := webhook.SendPaymentHook(hook); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
@@ -386,18 +906,17 @@ func PaymentCancel(c *fiber.Ctx) error {
 	}
 
 	db := queries.DB()
-	err := db.UpdateCart(c.Context(), &models.Cart{
-		Core: models.Core{
-			ID: payment.CartID,
-		},
-		PaymentStatus: litepay.CANCELED,
-		PaymentSystem: payment.PaymentSystem,
-	})
+	canceled, err := db.CancelCart(c.Context(), payment.CartID, payment.PaymentSystem)
 	if err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
+	// the cart is unknown, paid or canceled already
+	if !canceled {
+		return c.Render("cancel", nil, "layouts/main")
+	}
+
 	// send hook
 	hook := &webhook.Payment{
 		Event:     webhook.PAYMENT_CANCEL,
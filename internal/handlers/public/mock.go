@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vuisme/litecart/internal/checkout"
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/logging"
+	"github.com/vuisme/litecart/pkg/webutil"
+)
+
+// mockResults maps the choice on the mock payment page to the payment status.
+// A paid mock payment is a test payment, it is not counted as revenue.
+var mockResults = map[string]litepay.Status{
+	"paid":    litepay.TEST,
+	"pending": litepay.PROCESSED,
+	"failed":  litepay.FAILED,
+}
+
+// PaymentMock is ...
+// [get] /cart/payment/mock
+func PaymentMock(c *fiber.Ctx) error {
+	log := logging.New()
+
+	cart, setting, err := mockCart(c)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if cart == nil || !setting.Active {
+		return c.Status(fiber.StatusNotFound).Render("404", fiber.Map{}, "layouts/clear")
+	}
+
+	return c.Render("mock", fiber.Map{
+		"CartID": cart.ID,
+		"Email":  cart.Email,
+		"Amount": litepay.FormatPrice(cart.AmountTotal, cart.Currency),
+	}, "layouts/main")
+}
+
+// PaymentMockResult stores the result chosen on the mock payment page, as the
+// callback of a payment system would, and redirects the buyer.
+// [post] /cart/payment/mock
+func PaymentMockResult(c *fiber.Ctx) error {
+	log := logging.New()
+
+	cart, setting, err := mockCart(c)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if cart == nil || !setting.Active {
+		return webutil.StatusNotFound(c)
+	}
+
+	query := fmt.Sprintf("?payment_system=%s&cart_id=%s", litepay.MOCK, cart.ID)
+	result := c.FormValue("result")
+	if result == "canceled" {
+		return c.Redirect("/cart/payment/cancel" + query)
+	}
+
+	status, ok := mockResults[result]
+	if !ok {
+		return webutil.StatusBadRequest(c, "Unknown payment result")
+	}
+
+	if !cart.PaymentStatus.Paid() && cart.PaymentStatus != status {
+		payment := &litepay.Payment{
+			PaymentSystem: litepay.MOCK,
+			MerchantID:    "mock_" + cart.ID,
+			CartID:        cart.ID,
+			AmountTotal:   cart.AmountTotal,
+			Currency:      cart.Currency,
+			Status:        status,
+		}
+
+		changed, err := checkout.UpdatePayment(c.Context(), cart, payment)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		if changed {
+			hook := checkout.PaymentHook(webhook.PAYMENT_CALLBACK, cart, payment)
+			if err := webhook.SendPaymentHook(hook); err != nil {
+				log.ErrorStack(err)
+				return webutil.StatusInternalServerError(c)
+			}
+		}
+	}
+
+	if status == litepay.FAILED {
+		return c.Redirect("/cart")
+	}
+	return c.Redirect("/cart/payment/success" + query)
+}
+
+// mockCart returns the cart of the mock payment page with the mock settings.
+// The cart is nil when it does not exist or was not created by the mock payment system.
+func mockCart(c *fiber.Ctx) (*models.Cart, *models.PaymentProvider, error) {
+	db := queries.DB()
+
+	provider, ok := litepay.Lookup(litepay.MOCK)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	setting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cart, err := db.Cart(c.Context(), c.Query("cart_id"))
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return nil, setting, nil
+		}
+		return nil, nil, err
+	}
+
+	if cart.PaymentSystem != litepay.MOCK {
+		return nil, setting, nil
+	}
+
+	return cart, setting, nil
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vuisme/litecart/internal/mailer"
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/logging"
+	"github.com/vuisme/litecart/pkg/webutil"
+)
+
+// PaymentLink shows the page on which the buyer pays a stored cart again,
+// it is the link of the prepayment letter.
+// [get] /cart/:cart_id/pay
+func PaymentLink(c *fiber.Ctx) error {
+	log := logging.New()
+
+	cart, err := linkedCart(c, c.Query("token"))
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if cart == nil {
+		return c.Status(fiber.StatusNotFound).Render("404", fiber.Map{}, "layouts/clear")
+	}
+
+	return c.Render("pay", fiber.Map{
+		"CartID":   cart.ID,
+		"Token":    c.Query("token"),
+		"Amount":   litepay.FormatPrice(cart.AmountTotal, cart.Currency),
+		"Provider": cart.PaymentSystem,
+		"Payable":  cart.Payable(),
+	}, "layouts/main")
+}
+
+// PaymentRenew starts a new payment session of a stored cart that is not
+// paid, for example when the buyer left the page of the payment system or
+// the session expired. The buyer can choose another payment system.
+// [post] /cart/:cart_id/pay
+func PaymentRenew(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.CartRepayment)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	order, err := linkedCart(c, request.Token)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if order == nil {
+		return webutil.StatusNotFound(c)
+	}
+
+	if !order.Payable() {
+		return webutil.StatusBadRequest(c, "Cart can not be paid again")
+	}
+
+	// products sold out since the cart was stored are not dropped from it
+	unavailable, err := checkStock(c.Context(), order.Cart)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if unavailable != nil {
+		return webutil.StatusBadRequest(c, unavailable)
+	}
+
+	setting, err := db.GetSettingByKey(c.Context(), "domain")
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	domain := setting["domain"].Value.(string)
+
+	payment := &models.CartPayment{
+		Email:    order.Email,
+		Provider: order.PaymentSystem,
+		Products: order.Cart,
+		Coupon:   order.Coupon,
+	}
+	if request.Provider != "" {
+		payment.Provider = request.Provider
+	}
+	if order.Tax != nil {
+		payment.Country = order.Tax.Country
+		payment.VatID = order.Tax.VatID
+	}
+
+	priced, reason, err := priceCart(c.Context(), payment, domain, order.Currency, order.ID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if reason != "" {
+		return webutil.StatusBadRequest(c, reason)
+	}
+
+	cart := litepay.Cart{
+		ID:       order.ID,
+		Email:    order.Email,
+		Currency: order.Currency,
+		Items:    priced.Items,
+		Locale:   webutil.Language(c),
+	}
+	amountTotal := cart.AmountTotal()
+	if amountTotal == 0 {
+		return webutil.StatusBadRequest(c, "Cart has nothing to pay")
+	}
+
+	provider, ok := litepay.Lookup(payment.Provider)
+	if !ok {
+		return webutil.StatusBadRequest(c, "Payment system is not available")
+	}
+
+	providerSetting, err := db.GetPaymentProvider(c.Context(), provider)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if !providerSetting.Active {
+		return webutil.StatusBadRequest(c, "Payment system is not available")
+	}
+	if !provider.SupportCurrency(cart.Currency) {
+		return webutil.StatusBadRequest(c, "Payment system does not support the currency of the cart")
+	}
+	if len(cart.Intervals()) > 0 && !provider.Recurring {
+		return webutil.StatusBadRequest(c, "Subscriptions can not be paid with this payment system")
+	}
+
+	callbackURL := fmt.Sprintf("https://%s/cart/payment/callback", domain)
+	successURL := fmt.Sprintf("https://%s/cart/payment/success", domain)
+	cancelURL := fmt.Sprintf("https://%s/cart/payment/cancel", domain)
+	pay := litepay.New(callbackURL, successURL, cancelURL)
+
+	// the previous session is closed first, so that the cart can not be paid twice
+	if err := expireSession(c.Context(), order); err != nil {
+		log.Warn().Err(err).Str("cart_id", order.ID).Msg("previous payment session can not be closed")
+		return webutil.Response(c, fiber.StatusConflict, "Previous payment can not be canceled, try again later", nil)
+	}
+
+	response, err := provider.New(pay, providerSetting.Settings).Pay(cart)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	order.Cart = priced.Lines
+	order.AmountTotal = amountTotal
+	order.AmountDiscount = priced.AmountDiscount
+	order.Tax = priced.Tax
+	order.AmountTax = 0
+	if priced.Tax != nil {
+		order.AmountTax = priced.Tax.AmountTax
+	}
+	order.PaymentID = response.MerchantID
+	order.PaymentSystem = payment.Provider
+	order.PaymentStatus = litepay.NEW
+	if response.Status == litepay.AWAITING_PAYMENT {
+		order.PaymentStatus = response.Status
+	}
+
+	renewed, err := db.RepayCart(c.Context(), order)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	// the cart was paid in the meantime or its coupon has no use left
+	if !renewed {
+		return webutil.StatusBadRequest(c, "Cart can not be paid again")
+	}
+
+	// send email
+	if order.PaymentStatus == litepay.AWAITING_PAYMENT {
+		if err := mailer.SendInstructionsLetter(order.Email, amountTotal, order.Currency, order.ID, response.Instructions); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+	}
+
+	// send hook
+	hook := &webhook.Payment{
+		Event:     webhook.PAYMENT_INITIATION,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem: order.PaymentSystem,
+			PaymentStatus: order.PaymentStatus,
+			CartID:        order.ID,
+			TotalAmount:   amountTotal,
+			Currency:      order.Currency,
+			CartItems:     priced.Items,
+		},
+	}
+	if err := webhook.SendPaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Payment url", response.URL)
+}
+
+// linkedCart returns the cart of the payment link. The cart is nil when it
+// does not exist or the token was not issued for it.
+func linkedCart(c *fiber.Ctx, token string) (*models.Cart, error) {
+	db := queries.DB()
+
+	cart, err := db.Cart(c.Context(), c.Params("cart_id"))
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	valid, err := db.CheckCartPaymentToken(c.Context(), cart.ID, token)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, nil
+	}
+
+	return cart, nil
+}
+
+// expireSession closes the payment session of the cart in its payment system.
+// Sessions of payment systems that can not close them are left open, a payment
+// of such a session is reported by the callback.
+func expireSession(ctx context.Context, cart *models.Cart) error {
+	db := queries.DB()
+
+	provider, ok := litepay.Lookup(cart.PaymentSystem)
+	if !ok || cart.PaymentID == "" {
+		return nil
+	}
+
+	setting, err := db.GetPaymentProvider(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	expirer, ok := provider.New(litepay.New("", "", ""), setting.Settings).(litepay.Expirer)
+	if !ok {
+		return nil
+	}
+
+	return expirer.Expire(&litepay.Payment{
+		CartID:        cart.ID,
+		MerchantID:    cart.PaymentID,
+		PaymentSystem: cart.PaymentSystem,
+	})
+}
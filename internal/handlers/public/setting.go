@@ -39,6 +39,12 @@ func Settings(c *fiber.Ctx) error {
 		return webutil.StatusInternalServerError(c)
 	}
 
+	settingTax, err := queries.GetSettingByGroup[models.Tax](c.Context(), db)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
 	pages, err := db.ListPages(c.Context(), false)
 	if err != nil {
 		log.ErrorStack(err)
@@ -51,6 +57,10 @@ func Settings(c *fiber.Ctx) error {
 			"domain":    settingMain.Domain,
 			"currency":  settingPayment.Currency,
 		},
+		"tax": map[string]bool{
+			"active":    settingTax.Active,
+			"inclusive": settingTax.Inclusive,
+		},
 		"socials": settingSocial,
 		"pages":   pages,
 	})
@@ -7,6 +7,7 @@ import (
 
 	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/pkg/litepay"
 )
 
 // SendTestLetter is ...
@@ -37,6 +38,9 @@ func SendTestLetter(letterName string) error {
 			"Admin_Email":    "Admin Name <admin@mail.com>",
 			"Site_Name":      "Site name",
 			"Amount_Payment": "21.00 USD",
+			"Cart_ID":        "BbP4vZqFjR6RwVu",
+			"Products":       "Ebook x 1, 21.00 USD",
+			"Instructions":   "Bank: Bank name\nIBAN: DE00 0000 0000 0000 0000 00",
 		},
 	}
 
@@ -53,14 +57,44 @@ func SendTestLetter(letterName string) error {
 	return nil
 }
 
-// SendPrepaymentLetter is ...
-func SendPrepaymentLetter(email, amountPayment, paymentURL string) error {
+// SendPrepaymentLetter sends the link on which the buyer pays the cart, the
+// link keeps working when the payment session of the cart expires.
+func SendPrepaymentLetter(email string, amount int, currency, cartID string) error {
 	db := queries.DB()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	letter, err := db.CartLetterPayment(ctx, email, amountPayment, paymentURL)
+	paymentURL, err := db.CartPaymentLink(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	letter, err := db.CartLetterPayment(ctx, email, litepay.FormatPrice(amount, currency), paymentURL)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := SendMail(mailSetting, letter); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendInstructionsLetter is ...
+func SendInstructionsLetter(email string, amount int, currency, cartID, instructions string) error {
+	db := queries.DB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	letter, err := db.CartLetterInstructions(ctx, email, litepay.FormatPrice(amount, currency), cartID, instructions)
 	if err != nil {
 		return err
 	}
@@ -100,3 +134,75 @@ func SendCartLetter(cartID string) error {
 
 	return nil
 }
+
+// SendMismatchLetter is ...
+func SendMismatchLetter(cartID string) error {
+	db := queries.DB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	letter, err := db.CartLetterMismatch(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := SendMail(mailSetting, letter); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendOutOfStockLetter tells the admin about a paid cart whose keys could not be given.
+func SendOutOfStockLetter(cartID string) error {
+	db := queries.DB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	letter, err := db.CartLetterOutOfStock(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := SendMail(mailSetting, letter); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendRenewalLetter sends the content of the new period of a renewed subscription.
+func SendRenewalLetter(subscriptionID string) error {
+	db := queries.DB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	letter, err := db.SubscriptionLetterRenewal(ctx, subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := SendMail(mailSetting, letter); err != nil {
+		return err
+	}
+
+	return nil
+}
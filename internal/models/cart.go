@@ -1,23 +1,75 @@
 package models
 
-import "github.com/vuisme/litecart/pkg/litepay"
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+
+	"github.com/vuisme/litecart/pkg/litepay"
+)
 
 // Cart is ...
 type Cart struct {
 	Core
-	Email         string                `json:"email"`
-	Cart          []CartProduct         `json:"cart,omitempty"`
-	AmountTotal   int                   `json:"amount_total"`
-	Currency      string                `json:"currency"`
-	PaymentID     string                `json:"payment_id"`
-	PaymentStatus litepay.Status        `json:"payment_status"`
-	PaymentSystem litepay.PaymentSystem `json:"payment_system"`
+	Email          string                `json:"email"`
+	Cart           []CartProduct         `json:"cart,omitempty"`
+	AmountTotal    int                   `json:"amount_total"`
+	AmountRefunded int                   `json:"amount_refunded,omitempty"`
+	AmountPaid     int                   `json:"amount_paid,omitempty"`   // set when the payment does not match the cart or was discounted by the payment system
+	CurrencyPaid   string                `json:"currency_paid,omitempty"` // set when the payment does not match the cart
+	AmountDiscount int                   `json:"amount_discount,omitempty"`
+	Coupon         string                `json:"coupon,omitempty"`
+	AmountTax      int                   `json:"amount_tax,omitempty"`
+	Tax            *CartTax              `json:"tax,omitempty"`
+	Currency       string                `json:"currency"`
+	PaymentID      string                `json:"payment_id"`
+	PaymentStatus  litepay.Status        `json:"payment_status"`
+	PaymentSystem  litepay.PaymentSystem `json:"payment_system"`
+}
+
+// Payable reports whether the buyer can start a new payment of the cart:
+// it is not paid and no payment of it is being processed.
+func (v Cart) Payable() bool {
+	switch v.PaymentStatus {
+	case litepay.NEW, litepay.UNPAID, litepay.CANCELED, litepay.FAILED, litepay.AWAITING_PAYMENT:
+		return true
+	}
+	return false
 }
 
-// CartProduct is ...
+// CartProduct is a line of the cart. The buyer sends the product, the quantity
+// and the chosen price, the rest is the snapshot of the product taken at
+// checkout, so that the cart shows what was bought after the product changes.
 type CartProduct struct {
-	ProductID string `json:"id"`
-	Quantity  int    `json:"quantity"`
+	ProductID   string `json:"id"`
+	Quantity    int    `json:"quantity"`
+	Amount      *int   `json:"amount,omitempty"` // unit price chosen by the buyer of a pay-what-you-want product
+	Name        string `json:"name,omitempty"`
+	Slug        string `json:"slug,omitempty"`
+	UnitAmount  int    `json:"unit_amount,omitempty"` // price of a unit before the coupon
+	Currency    string `json:"currency,omitempty"`
+	DigitalType string `json:"digital_type,omitempty"`
+}
+
+// maxCartQuantity is the highest quantity of a product in a cart.
+const maxCartQuantity = 1000
+
+// Validate is ...
+func (v CartProduct) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.ProductID, validation.Required, validation.Length(15, 15)),
+		validation.Field(&v.Quantity, validation.Required, validation.Min(1), validation.Max(maxCartQuantity)),
+		validation.Field(&v.Amount, validation.Min(0)),
+	)
+}
+
+// CartKey is a digital_data key delivered with a cart, one per unit bought.
+type CartKey struct {
+	ProductID string `json:"product_id"`
+	Content   string `json:"content"`
 }
 
 // CartPayment is ...
@@ -25,4 +77,88 @@ type CartPayment struct {
 	Email    string                `json:"email"`
 	Provider litepay.PaymentSystem `json:"provider"`
 	Products []CartProduct         `json:"products"`
+	Coupon   string                `json:"coupon,omitempty"`
+	Country  string                `json:"country,omitempty"` // ISO 3166-1 alpha-2 code, required when taxes are active
+	VatID    string                `json:"vat_id,omitempty"`
+}
+
+// Validate checks the checkout request. Whether the products can be sold and
+// the payment system is active is checked against the database by the handler.
+func (v CartPayment) Validate() error {
+	return validation.ValidateStruct(&v,
+		// the format only, a DNS lookup of the domain would slow down every checkout
+		validation.Field(&v.Email, validation.Required, is.EmailFormat),
+		validation.Field(&v.Products, validation.Required, validation.By(uniqueProducts)),
+		validation.Field(&v.Country, is.CountryCode2),
+	)
+}
+
+// uniqueProducts checks that every product is in the cart once, the quantity
+// of a product is set on its line.
+func uniqueProducts(value any) error {
+	seen := map[string]bool{}
+	for _, product := range value.([]CartProduct) {
+		if seen[product.ProductID] {
+			return errors.New("must not contain a product twice")
+		}
+		seen[product.ProductID] = true
+	}
+	return nil
+}
+
+// CartRepayment is a new payment of a stored cart, started from the link of
+// the prepayment letter.
+type CartRepayment struct {
+	Token    string                `json:"token"`
+	Provider litepay.PaymentSystem `json:"provider,omitempty"` // the payment system of the cart when empty
+}
+
+// vatIDPattern is the format of a VAT identification number without separators.
+var vatIDPattern = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,13}$`)
+
+// NormalizeVatID removes separators from the VAT ID and reports whether it has
+// the format of a VAT ID issued in the country. Greek VAT IDs start with EL.
+// The number itself is not checked with the tax authorities.
+func NormalizeVatID(vatID, country string) (string, bool) {
+	vatID = strings.ToUpper(strings.NewReplacer(" ", "", ".", "", "-", "").Replace(vatID))
+	prefix := strings.ToUpper(country)
+	if prefix == "GR" {
+		prefix = "EL"
+	}
+	return vatID, vatIDPattern.MatchString(vatID) && strings.HasPrefix(vatID, prefix)
+}
+
+// CartTax is the tax breakdown of a cart, kept for invoices and exports.
+type CartTax struct {
+	Country       string    `json:"country"`
+	VatID         string    `json:"vat_id,omitempty"`
+	Zone          string    `json:"zone,omitempty"`
+	Rate          int       `json:"rate"` // hundredths of a percent
+	Inclusive     bool      `json:"inclusive"`
+	ReverseCharge bool      `json:"reverse_charge,omitempty"`
+	AmountNet     int       `json:"amount_net"`
+	AmountTax     int       `json:"amount_tax"`
+	AmountGross   int       `json:"amount_gross"`
+	Lines         []TaxLine `json:"lines"`
+}
+
+// TaxLine is the tax of a line of the cart.
+type TaxLine struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Net      int    `json:"net"`
+	Tax      int    `json:"tax"`
+	Gross    int    `json:"gross"`
+}
+
+// CartRefund is ...
+type CartRefund struct {
+	Amount int `json:"amount"` // 0 refunds the whole remaining amount
+}
+
+// Validate is ...
+func (v CartRefund) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Amount, validation.Min(0)),
+	)
 }
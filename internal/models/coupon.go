@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// coupon types
+const (
+	CouponPercent = "percent" // Value is a percentage of the amount
+	CouponFixed   = "fixed"   // Value is an amount in minor units of the shop currency
+)
+
+// Coupon is ...
+type Coupon struct {
+	Core
+	Code         string   `json:"code"`
+	Type         string   `json:"type"`
+	Value        int      `json:"value"`
+	Products     []string `json:"products,omitempty"`       // empty applies the coupon to every product
+	MaxUses      int      `json:"max_uses,omitempty"`       // 0 is unlimited
+	MaxUsesEmail int      `json:"max_uses_email,omitempty"` // 0 is unlimited
+	ValidFrom    int64    `json:"valid_from,omitempty"`
+	ValidUntil   int64    `json:"valid_until,omitempty"`
+	Active       bool     `json:"active"`
+	Uses         int      `json:"uses"`
+}
+
+// Validate is ...
+func (v Coupon) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.ID, validation.Length(15, 15)),
+		validation.Field(&v.Code, validation.Required, validation.Length(3, 30)),
+		validation.Field(&v.Type, validation.Required, validation.In(CouponPercent, CouponFixed)),
+		validation.Field(&v.Value, validation.Required, validation.Min(1), validation.When(v.Type == CouponPercent, validation.Max(100))),
+		validation.Field(&v.Products, validation.Each(validation.Length(15, 15))),
+		validation.Field(&v.MaxUses, validation.Min(0)),
+		validation.Field(&v.MaxUsesEmail, validation.Min(0)),
+		validation.Field(&v.ValidUntil, validation.When(v.ValidFrom > 0 && v.ValidUntil > 0, validation.Min(v.ValidFrom))),
+	)
+}
+
+// Available returns an error when the coupon can not be used at the given time.
+func (v Coupon) Available(now time.Time) error {
+	switch {
+	case !v.Active:
+		return errors.New("coupon is not active")
+	case v.ValidFrom > 0 && now.Unix() < v.ValidFrom:
+		return errors.New("coupon is not valid yet")
+	case v.ValidUntil > 0 && now.Unix() > v.ValidUntil:
+		return errors.New("coupon has expired")
+	}
+	return nil
+}
+
+// AppliesTo reports whether the coupon discounts the product.
+func (v Coupon) AppliesTo(productID string) bool {
+	if len(v.Products) == 0 {
+		return true
+	}
+	for _, id := range v.Products {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount returns the discount of the coupon for the amount, it is never more than the amount.
+func (v Coupon) Discount(amount int) int {
+	discount := v.Value
+	if v.Type == CouponPercent {
+		discount = amount * v.Value / 100
+	}
+	return min(discount, amount)
+}
@@ -3,6 +3,14 @@ package models
 import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+
+	"github.com/vuisme/litecart/pkg/litepay"
+)
+
+// Billing types of a product.
+const (
+	BillingOneOff    = "one_off"
+	BillingRecurring = "recurring"
 )
 
 // Products is ...
@@ -15,22 +23,27 @@ type Products struct {
 // Product is ...
 type Product struct {
 	Core
-	Name        string     `json:"name"`
-	Brief       string     `json:"brief,omitempty"`
-	Description string     `json:"description,omitempty"`
-	Images      []File     `json:"images,omitempty"`
-	Slug        string     `json:"slug"`
-	Amount      int        `json:"amount"`
-	Metadata    []Metadata `json:"metadata,omitempty"`
-	Attributes  []string   `json:"attributes,omitempty"`
-	Digital     Digital    `json:"digital,omitempty"`
-	Active      bool       `json:"active"`
-	Seo         *Seo       `json:"seo,omitempty"`
+	Name            string     `json:"name"`
+	Brief           string     `json:"brief,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	Images          []File     `json:"images,omitempty"`
+	Slug            string     `json:"slug"`
+	Amount          int        `json:"amount"`
+	Billing         string     `json:"billing"`
+	Interval        string     `json:"interval,omitempty"`          // billing interval of a recurring product
+	PayWhatYouWant  bool       `json:"pay_what_you_want,omitempty"` // the buyer chooses the price, not lower than MinAmount
+	MinAmount       int        `json:"min_amount,omitempty"`
+	SuggestedAmount int        `json:"suggested_amount,omitempty"` // price offered to the buyer of a pay-what-you-want product
+	Metadata        []Metadata `json:"metadata,omitempty"`
+	Attributes      []string   `json:"attributes,omitempty"`
+	Digital         Digital    `json:"digital,omitempty"`
+	Active          bool       `json:"active"`
+	Seo             *Seo       `json:"seo,omitempty"`
 }
 
 // Validate is ...
 func (v Product) Validate() error {
-	return validation.ValidateStruct(&v,
+	return validation.ValidateStruct(&v, append(v.pricingRules(),
 		validation.Field(&v.ID, validation.Length(15, 15)),
 		validation.Field(&v.Name, validation.Length(3, 50)),
 		validation.Field(&v.Description, validation.NotNil),
@@ -41,7 +54,62 @@ func (v Product) Validate() error {
 		validation.Field(&v.Attributes, validation.Each(validation.Length(3, 254))),
 		validation.Field(&v.Digital),
 		validation.Field(&v.Seo),
-	)
+	)...)
+}
+
+// ValidatePricing checks how the product is billed and priced: the interval of
+// a recurring product and the minimum and suggested prices of a pay-what-you-want product.
+func (v Product) ValidatePricing() error {
+	return validation.ValidateStruct(&v, v.pricingRules()...)
+}
+
+// NormalizePricing sets the defaults of the pricing of a product sent by the
+// admin and checks it: a product without a billing type is paid once and the
+// listed price of a pay-what-you-want product is the price offered to the buyer.
+func (v *Product) NormalizePricing() error {
+	if v.Billing == "" {
+		v.Billing = BillingOneOff
+	}
+	if err := v.ValidatePricing(); err != nil {
+		return err
+	}
+	if v.PayWhatYouWant {
+		v.Amount = v.Price(nil)
+	}
+	return nil
+}
+
+func (v *Product) pricingRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&v.Billing, validation.Required, validation.In(BillingOneOff, BillingRecurring)),
+		validation.Field(&v.Interval, validation.When(v.Billing == BillingRecurring,
+			validation.Required, validation.In("day", "week", "month", "year"),
+		).Else(validation.Empty)),
+		validation.Field(&v.MinAmount, validation.Min(0)),
+		validation.Field(&v.SuggestedAmount, validation.When(v.PayWhatYouWant, validation.Min(v.MinAmount))),
+	}
+}
+
+// Price returns the unit amount of the product for the price chosen by the
+// buyer, which is nil when the buyer did not choose one. The chosen price of
+// a pay-what-you-want product is not checked against the minimum here.
+func (v Product) Price(chosen *int) int {
+	switch {
+	case !v.PayWhatYouWant:
+		return v.Amount
+	case chosen != nil:
+		return *chosen
+	default:
+		return max(v.SuggestedAmount, v.MinAmount)
+	}
+}
+
+// Recurring returns the billing period of a recurring product, or nil.
+func (v Product) Recurring() *litepay.Recurring {
+	if v.Billing != BillingRecurring {
+		return nil
+	}
+	return &litepay.Recurring{Interval: v.Interval}
 }
 
 // Metadata is ...
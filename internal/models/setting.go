@@ -1,8 +1,13 @@
 package models
 
 import (
+	"regexp"
+	"strings"
+
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+
+	"github.com/vuisme/litecart/pkg/litepay"
 )
 
 // Main is ...
@@ -60,16 +65,72 @@ func (v Payment) Validate() error {
 	)
 }
 
+// Tax is ...
+type Tax struct {
+	Active    bool      `json:"active"`
+	Inclusive bool      `json:"inclusive"` // product prices include the tax
+	Country   string    `json:"country"`   // country of the shop, its buyers are never reverse charged
+	Zones     []TaxZone `json:"zones"`
+}
+
+// Validate is ...
+func (v Tax) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Country, validation.When(v.Active, validation.Required), is.CountryCode2),
+		validation.Field(&v.Zones),
+	)
+}
+
+// Zone returns the tax zone of the country, or nil when the country is not taxed.
+func (v Tax) Zone(country string) *TaxZone {
+	for i, zone := range v.Zones {
+		for _, code := range zone.Countries {
+			if strings.EqualFold(code, country) {
+				return &v.Zones[i]
+			}
+		}
+	}
+	return nil
+}
+
+// TaxZone is a group of countries with the same tax rate.
+type TaxZone struct {
+	Name          string   `json:"name"`
+	Countries     []string `json:"countries"` // ISO 3166-1 alpha-2 codes
+	Rate          int      `json:"rate"`      // hundredths of a percent, 2000 is 20%
+	ReverseCharge bool     `json:"reverse_charge"`
+}
+
+// Validate is ...
+func (v TaxZone) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 30)),
+		validation.Field(&v.Countries, validation.Required, validation.Each(is.CountryCode2)),
+		validation.Field(&v.Rate, validation.Min(0), validation.Max(10000)),
+	)
+}
+
 // Stripe is ...
 type Stripe struct {
-	SecretKey string `json:"secret_key"`
-	Active    bool   `json:"active"`
+	SecretKey      string `json:"secret_key"`
+	WebhookSecret  string `json:"webhook_secret"`
+	Mode           string `json:"mode"`
+	Locale         string `json:"locale"`
+	BillingAddress bool   `json:"billing_address"`
+	PromotionCodes bool   `json:"promotion_codes"`
+	Active         bool   `json:"active"`
 }
 
+// stripeLocalePattern is "auto" or a locale of the Stripe Checkout page ("de", "pt-BR", "es-419").
+var stripeLocalePattern = regexp.MustCompile(`^(auto|[a-z]{2,3}(-[A-Z0-9]{2,3})?)$`)
+
 // Validate is ...
 func (v Stripe) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.SecretKey, validation.Length(100, 130)),
+		validation.Field(&v.WebhookSecret, validation.Length(30, 100)),
+		validation.Field(&v.Mode, validation.In(string(litepay.SANDBOX), string(litepay.LIVE))),
+		validation.Field(&v.Locale, validation.Match(stripeLocalePattern)),
 	)
 }
 
@@ -77,6 +138,7 @@ func (v Stripe) Validate() error {
 type Paypal struct {
 	ClientID  string `json:"client_id"`
 	SecretKey string `json:"secret_key"`
+	Mode      string `json:"mode"`
 	Active    bool   `json:"active"`
 }
 
@@ -85,15 +147,20 @@ func (v Paypal) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.ClientID, validation.Length(80, 80)),
 		validation.Field(&v.SecretKey, validation.Length(80, 80)),
+		validation.Field(&v.Mode, validation.In(string(litepay.SANDBOX), string(litepay.LIVE))),
 	)
 }
 
+// spectrocoinPayCurrencyPattern matches the coins Spectrocoin can be paid with.
+var spectrocoinPayCurrencyPattern = regexp.MustCompile(`^(` + strings.Join(litepay.SpectrocoinPayCurrency, "|") + `)$`)
+
 // Spectrocoin is ...
 type Spectrocoin struct {
-	MerchantID string `json:"merchant_id"`
-	ProjectID  string `json:"project_id"`
-	PrivateKey string `json:"private_key"`
-	Active     bool   `json:"active"`
+	MerchantID  string `json:"merchant_id"`
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	PayCurrency string `json:"pay_currency"` // coin the buyer pays with
+	Active      bool   `json:"active"`
 }
 
 // Validate is ...
@@ -102,9 +169,30 @@ func (v Spectrocoin) Validate() error {
 		validation.Field(&v.MerchantID, is.UUID),
 		validation.Field(&v.ProjectID, is.UUID),
 		validation.Field(&v.PrivateKey, validation.Length(1700, 2200)),
+		validation.Field(&v.PayCurrency, validation.Match(spectrocoinPayCurrencyPattern)),
 	)
 }
 
+// PaymentProvider is the stored state of a registered payment system.
+type PaymentProvider struct {
+	Name     litepay.PaymentSystem `json:"name"`
+	Active   bool                  `json:"active"`
+	Settings litepay.Settings      `json:"settings"`
+}
+
+// Sandbox reports whether the payment system is switched to its test environment.
+func (v PaymentProvider) Sandbox() bool {
+	return v.Settings["mode"] == string(litepay.SANDBOX)
+}
+
+// SandboxStatus keeps payments made in the test environment of a payment system out of revenue.
+func (v PaymentProvider) SandboxStatus(status litepay.Status) litepay.Status {
+	if v.Sandbox() && status == litepay.PAID {
+		return litepay.TEST
+	}
+	return status
+}
+
 // PaymentSystem is ...
 type PaymentSystem struct {
 	Active      []string    `json:"active"`
@@ -122,6 +210,20 @@ func (v PaymentSystem) Validate() error {
 	)
 }
 
+// Reconcile is ...
+type Reconcile struct {
+	MaxAge  int `json:"max_age"`  // hours, carts younger than this are checked with the payment system
+	CartTTL int `json:"cart_ttl"` // hours, unpaid carts older than this are canceled
+}
+
+// Validate is ...
+func (v Reconcile) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.MaxAge, validation.Required, validation.Min(1)),
+		validation.Field(&v.CartTTL, validation.Required, validation.Min(1)),
+	)
+}
+
 type Webhook struct {
 	Url string `json:"url"`
 }
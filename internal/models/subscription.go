@@ -0,0 +1,20 @@
+package models
+
+import "github.com/vuisme/litecart/pkg/litepay"
+
+// Subscription is a recurring payment bought with a cart. The recurring
+// products of the cart are delivered again on every renewal.
+type Subscription struct {
+	Core
+	CartID            string                     `json:"cart_id"`
+	Email             string                     `json:"email"`
+	PaymentSystem     litepay.PaymentSystem      `json:"payment_system"`
+	SubscriptionID    string                     `json:"subscription_id"` // ID of the subscription in the payment system
+	CustomerID        string                     `json:"customer_id,omitempty"`
+	Status            litepay.SubscriptionStatus `json:"status"`
+	CurrentPeriodEnd  int64                      `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd bool                       `json:"cancel_at_period_end,omitempty"`
+	Renewals          int                        `json:"renewals"`
+	LastInvoice       string                     `json:"last_invoice,omitempty"`
+	RenewalDelivered  bool                       `json:"renewal_delivered"` // the letter of the last renewal was sent
+}
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/pkg/errors"
 	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/security"
 )
 
 // CartQueries is a struct that embeds a pointer to an sql.DB.
@@ -19,11 +21,14 @@ type CartQueries struct {
 	*sql.DB
 }
 
-// PaymentList retrieves the status of different payment methods from the database.
+// PaymentList retrieves the status of the registered payment systems from the database.
+// Payment systems that do not accept the currency of the shop are not available.
 func (q *CartQueries) PaymentList(ctx context.Context) (map[string]bool, error) {
 	payments := map[string]bool{}
-	keys := []any{
-		"stripe_active", "paypal_active", "spectrocoin_active",
+	keys := []any{"currency"}
+	for _, provider := range litepay.Providers() {
+		payments[string(provider.Name)] = false
+		keys = append(keys, string(provider.Name)+"_active")
 	}
 
 	query := fmt.Sprintf("SELECT key, value FROM setting WHERE key IN (%s)", strings.Repeat("?, ", len(keys)-1)+"?")
@@ -33,6 +38,7 @@ func (q *CartQueries) PaymentList(ctx context.Context) (map[string]bool, error)
 	}
 	defer rows.Close()
 
+	var currency string
 	for rows.Next() {
 		var key, value string
 		err := rows.Scan(&key, &value)
@@ -40,6 +46,11 @@ func (q *CartQueries) PaymentList(ctx context.Context) (map[string]bool, error)
 			return nil, err
 		}
 
+		if key == "currency" {
+			currency = value
+			continue
+		}
+
 		vBool, err := strconv.ParseBool(value)
 		if err != nil {
 			return nil, err
@@ -52,6 +63,15 @@ func (q *CartQueries) PaymentList(ctx context.Context) (map[string]bool, error)
 		return nil, err
 	}
 
+	for _, provider := range litepay.Providers() {
+		if DevMode && provider.Dev {
+			payments[string(provider.Name)] = true
+		}
+		if !provider.SupportCurrency(currency) {
+			payments[string(provider.Name)] = false
+		}
+	}
+
 	return payments, nil
 }
 
@@ -63,7 +83,15 @@ func (q *CartQueries) Carts(ctx context.Context) ([]*models.Cart, error) {
 	SELECT 
 		id, 
 		email, 
+		cart,
 		amount_total,
+		amount_refunded,
+		amount_paid,
+		currency_paid,
+		amount_discount,
+		coupon,
+		amount_tax,
+		tax,
 		currency,
 		payment_id,
 		payment_status,
@@ -80,14 +108,22 @@ func (q *CartQueries) Carts(ctx context.Context) ([]*models.Cart, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var email, paymentID sql.NullString
+		var email, products, paymentID, tax sql.NullString
 		var updated sql.NullInt64
 		cart := &models.Cart{}
 
 		err := rows.Scan(
 			&cart.ID,
 			&email,
+			&products,
 			&cart.AmountTotal,
+			&cart.AmountRefunded,
+			&cart.AmountPaid,
+			&cart.CurrencyPaid,
+			&cart.AmountDiscount,
+			&cart.Coupon,
+			&cart.AmountTax,
+			&tax,
 			&cart.Currency,
 			&paymentID,
 			&cart.PaymentStatus,
@@ -105,6 +141,18 @@ func (q *CartQueries) Carts(ctx context.Context) ([]*models.Cart, error) {
 			cart.Updated = updated.Int64
 		}
 
+		if products.Valid {
+			if err := json.Unmarshal([]byte(products.String), &cart.Cart); err != nil {
+				return nil, err
+			}
+		}
+
+		if tax.Valid {
+			if err := json.Unmarshal([]byte(tax.String), &cart.Tax); err != nil {
+				return nil, err
+			}
+		}
+
 		carts = append(carts, cart)
 	}
 
@@ -121,17 +169,26 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
 	SELECT 
     id, 
     email, 
+    cart,
     amount_total,
+    amount_refunded,
+    amount_paid,
+    currency_paid,
+    amount_discount,
+    coupon,
+    amount_tax,
+    tax,
     currency,
     payment_id,
     payment_status,
+    payment_system,
     strftime('%s', created),
     strftime('%s', updated)
 	FROM cart
 	WHERE id = ?
 	`
 
-	var email, paymentID sql.NullString
+	var email, products, paymentID, tax sql.NullString
 	var created, updated sql.NullInt64
 	cart := &models.Cart{}
 
@@ -139,16 +196,25 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
 		Scan(
 			&cart.ID,
 			&email,
+			&products,
 			&cart.AmountTotal,
+			&cart.AmountRefunded,
+			&cart.AmountPaid,
+			&cart.CurrencyPaid,
+			&cart.AmountDiscount,
+			&cart.Coupon,
+			&cart.AmountTax,
+			&tax,
 			&cart.Currency,
 			&paymentID,
 			&cart.PaymentStatus,
+			&cart.PaymentSystem,
 			&created,
 			&updated,
 		)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.ErrProductNotFound
+			return nil, errors.ErrCartNotFound
 		}
 		return nil, err
 	}
@@ -163,19 +229,161 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
 		cart.Updated = updated.Int64
 	}
 
+	if products.Valid {
+		if err := json.Unmarshal([]byte(products.String), &cart.Cart); err != nil {
+			return nil, err
+		}
+	}
+
+	if tax.Valid {
+		if err := json.Unmarshal([]byte(tax.String), &cart.Tax); err != nil {
+			return nil, err
+		}
+	}
+
 	return cart, nil
 }
 
-// AddCart inserts a new cart into the database.
+// CartByPaymentID retrieves a cart from the database using the payment ID assigned by the payment system.
+func (q *CartQueries) CartByPaymentID(ctx context.Context, paymentID string) (*models.Cart, error) {
+	var cartID string
+	err := q.DB.QueryRowContext(ctx, `SELECT id FROM cart WHERE payment_id = ?`, paymentID).Scan(&cartID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrCartNotFound
+		}
+		return nil, err
+	}
+
+	return q.Cart(ctx, cartID)
+}
+
+// PendingCarts retrieves the carts whose payment is not finished yet.
+func (q *CartQueries) PendingCarts(ctx context.Context) ([]*models.Cart, error) {
+	carts := []*models.Cart{}
+
+	query := `
+	SELECT 
+		id, 
+		email, 
+		amount_total,
+		amount_discount,
+		currency,
+		payment_id,
+		payment_status,
+		payment_system,
+		strftime('%s', created)
+	FROM cart
+	WHERE payment_status IN (?, ?, ?)
+`
+
+	rows, err := q.DB.QueryContext(ctx, query, litepay.NEW, litepay.UNPAID, litepay.PROCESSED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email, paymentID sql.NullString
+		cart := &models.Cart{}
+
+		err := rows.Scan(
+			&cart.ID,
+			&email,
+			&cart.AmountTotal,
+			&cart.AmountDiscount,
+			&cart.Currency,
+			&paymentID,
+			&cart.PaymentStatus,
+			&cart.PaymentSystem,
+			&cart.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		cart.Email = email.String
+		cart.PaymentID = paymentID.String
+
+		carts = append(carts, cart)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return carts, nil
+}
+
+// CountFreeCarts returns the number of free carts the email got within the period.
+func (q *CartQueries) CountFreeCarts(ctx context.Context, email string, period time.Duration) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM cart WHERE LOWER(email) = LOWER(?) AND payment_system = ? AND created > datetime('now', ?)`
+	err := q.DB.QueryRowContext(ctx, query, email, litepay.FREE, fmt.Sprintf("-%d seconds", int(period.Seconds()))).Scan(&count)
+	return count, err
+}
+
+// couponAvailable is the condition under which the coupon of a cart has a use
+// left for it, the cart itself is not counted. It takes couponAvailableArgs.
+const couponAvailable = `NOT EXISTS (
+		SELECT 1 FROM coupon WHERE coupon.code = ? COLLATE NOCASE AND (
+			(coupon.max_uses > 0 AND coupon.max_uses <= (
+				SELECT COUNT(*) FROM cart WHERE cart.coupon = coupon.code COLLATE NOCASE AND cart.id != ? AND cart.payment_status NOT IN (?, ?)
+			)) OR
+			(coupon.max_uses_email > 0 AND coupon.max_uses_email <= (
+				SELECT COUNT(*) FROM cart WHERE cart.coupon = coupon.code COLLATE NOCASE AND cart.id != ? AND LOWER(cart.email) = LOWER(?) AND cart.payment_status NOT IN (?, ?)
+			))
+		)
+	)`
+
+// couponAvailableArgs returns the arguments of couponAvailable for the cart.
+func couponAvailableArgs(cart *models.Cart) []any {
+	return []any{cart.Coupon, cart.ID, litepay.CANCELED, litepay.FAILED, cart.ID, cart.Email, litepay.CANCELED, litepay.FAILED}
+}
+
+// AddCart inserts a new cart into the database. It returns ErrCouponLimit and
+// inserts nothing when the coupon of the cart has no use left.
 func (q *CartQueries) AddCart(ctx context.Context, cart *models.Cart) error {
 	byteCart, err := json.Marshal(cart.Cart)
 	if err != nil {
 		return err
 	}
 
-	query := `INSERT INTO cart (id, email, cart, amount_total, currency, payment_status, payment_system) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err = q.DB.ExecContext(ctx, query, cart.ID, cart.Email, string(byteCart), cart.AmountTotal, cart.Currency, cart.PaymentStatus, cart.PaymentSystem)
-	return err
+	var paymentID sql.NullString
+	if cart.PaymentID != "" {
+		paymentID = sql.NullString{String: cart.PaymentID, Valid: true}
+	}
+
+	var tax sql.NullString
+	if cart.Tax != nil {
+		byteTax, err := json.Marshal(cart.Tax)
+		if err != nil {
+			return err
+		}
+		tax = sql.NullString{String: string(byteTax), Valid: true}
+	}
+
+	// the usage limits of the coupon are checked by the insert itself,
+	// so that two checkouts can not both take the last use
+	query := `
+	INSERT INTO cart (id, email, cart, amount_total, amount_discount, coupon, amount_tax, tax, currency, payment_id, payment_status, payment_system)
+	SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+	WHERE ` + couponAvailable
+	args := []any{cart.ID, cart.Email, string(byteCart), cart.AmountTotal, cart.AmountDiscount, cart.Coupon, cart.AmountTax, tax, cart.Currency, paymentID, cart.PaymentStatus, cart.PaymentSystem}
+	result, err := q.DB.ExecContext(ctx, query, append(args, couponAvailableArgs(cart)...)...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrCouponLimit
+	}
+
+	return nil
 }
 
 // UpdateCart updates the cart details in the database.
@@ -197,13 +405,266 @@ func (q *CartQueries) UpdateCart(ctx context.Context, cart *models.Cart) error {
 		args = append(args, cart.PaymentStatus)
 	}
 
-	sql.WriteString("updated = datetime('now') WHERE id = ?")
-	args = append(args, cart.ID)
+	// a paid, refunded, mismatched or undelivered cart is never moved back by a late notification
+	sql.WriteString("updated = datetime('now') WHERE id = ? AND payment_status NOT IN (?, ?, ?, ?, ?, ?)")
+	args = append(args, cart.ID, litepay.PAID, litepay.TEST, litepay.REFUNDED, litepay.PARTIALLY_REFUNDED, litepay.AMOUNT_MISMATCH, litepay.OUT_OF_STOCK)
 
 	_, err := q.DB.ExecContext(ctx, sql.String(), args...)
 	return err
 }
 
+// CancelCart moves a cart of the payment system that is not paid yet to the
+// canceled status. A payment that is processed is left to its notification.
+// It reports whether this call made the transition.
+func (q *CartQueries) CancelCart(ctx context.Context, cartID string, paymentSystem litepay.PaymentSystem) (bool, error) {
+	query := `
+	UPDATE cart 
+	SET payment_status = ?, updated = datetime('now') 
+	WHERE id = ? AND payment_system = ? AND payment_status IN (?, ?, ?)
+`
+	result, err := q.DB.ExecContext(ctx, query, litepay.CANCELED, cartID, paymentSystem,
+		litepay.NEW, litepay.UNPAID, litepay.FAILED)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// RepayCart stores a new payment session of an unpaid cart, with the payment
+// system chosen by the buyer and the lines and amounts of the rebuilt cart. It reports
+// whether the cart was still unpaid, so that a cart paid in the meantime is
+// not moved back, and whether its coupon still had a use left for it.
+func (q *CartQueries) RepayCart(ctx context.Context, cart *models.Cart) (bool, error) {
+	byteCart, err := json.Marshal(cart.Cart)
+	if err != nil {
+		return false, err
+	}
+
+	var tax sql.NullString
+	if cart.Tax != nil {
+		byteTax, err := json.Marshal(cart.Tax)
+		if err != nil {
+			return false, err
+		}
+		tax = sql.NullString{String: string(byteTax), Valid: true}
+	}
+
+	var paymentID sql.NullString
+	if cart.PaymentID != "" {
+		paymentID = sql.NullString{String: cart.PaymentID, Valid: true}
+	}
+
+	query := `
+	UPDATE cart 
+	SET cart = ?, amount_total = ?, amount_discount = ?, amount_tax = ?, tax = ?, payment_id = ?, payment_status = ?, payment_system = ?, updated = datetime('now') 
+	WHERE id = ? AND payment_status IN (?, ?, ?, ?, ?) AND ` + couponAvailable
+	args := []any{string(byteCart), cart.AmountTotal, cart.AmountDiscount, cart.AmountTax, tax, paymentID, cart.PaymentStatus, cart.PaymentSystem, cart.ID,
+		litepay.NEW, litepay.UNPAID, litepay.CANCELED, litepay.FAILED, litepay.AWAITING_PAYMENT}
+	result, err := q.DB.ExecContext(ctx, query, append(args, couponAvailableArgs(cart)...)...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// PayCart moves the cart to a paid status if it is not paid yet and gives it
+// the keys of its data products in the same transaction.
+// It reports whether this call made the transition, so that the purchase is
+// fulfilled only once when several notifications arrive for the same cart.
+// Nothing is changed and ErrNotEnoughKeys is returned when a product has too
+// few free keys, the caller moves the cart to out_of_stock with OutOfStockCart.
+// A cart that is out of stock is paid again once the admin has added keys.
+// AmountPaid is stored when the payment system granted a discount.
+func (q *CartQueries) PayCart(ctx context.Context, cart *models.Cart) (bool, error) {
+	if !cart.PaymentStatus.Paid() {
+		return false, fmt.Errorf("payment status %q is not paid", cart.PaymentStatus)
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE cart 
+	SET payment_id = COALESCE(NULLIF(?, ''), payment_id), payment_status = ?, amount_paid = ?, updated = datetime('now') 
+	WHERE id = ? AND payment_status NOT IN (?, ?, ?, ?, ?)
+`
+	result, err := tx.ExecContext(ctx, query, cart.PaymentID, cart.PaymentStatus, cart.AmountPaid, cart.ID,
+		litepay.PAID, litepay.TEST, litepay.REFUNDED, litepay.PARTIALLY_REFUNDED, litepay.AMOUNT_MISMATCH)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected != 1 {
+		return false, nil
+	}
+
+	var cartJSON string
+	if err := tx.QueryRowContext(ctx, `SELECT cart FROM cart WHERE id = ?`, cart.ID).Scan(&cartJSON); err != nil {
+		return false, err
+	}
+	products := []models.CartProduct{}
+	if err := json.Unmarshal([]byte(cartJSON), &products); err != nil {
+		return false, err
+	}
+
+	for _, product := range products {
+		digitalType := product.DigitalType
+		if digitalType == "" {
+			err := tx.QueryRowContext(ctx, `SELECT digital FROM product WHERE id = ?`, product.ProductID).Scan(&digitalType)
+			if err != nil && err != sql.ErrNoRows {
+				return false, err
+			}
+		}
+		if digitalType != "data" {
+			continue
+		}
+
+		// keys the cart already has are not given twice
+		given, err := cartProductKeys(ctx, tx, cart.ID, product.ProductID, unitCount(product))
+		if err != nil {
+			return false, err
+		}
+		if _, err := assignKeys(ctx, tx, cart.ID, product.ProductID, unitCount(product)-len(given)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// OutOfStockCart records a payment of a cart whose keys could not be given
+// and moves the cart to the out_of_stock status, which the admin reviews.
+// Like PayCart it reports whether this call made the transition.
+func (q *CartQueries) OutOfStockCart(ctx context.Context, cart *models.Cart) (bool, error) {
+	query := `
+	UPDATE cart 
+	SET payment_id = COALESCE(NULLIF(?, ''), payment_id), payment_status = ?, amount_paid = ?, updated = datetime('now') 
+	WHERE id = ? AND payment_status NOT IN (?, ?, ?, ?, ?, ?)
+`
+	result, err := q.DB.ExecContext(ctx, query, cart.PaymentID, litepay.OUT_OF_STOCK, cart.AmountPaid, cart.ID,
+		litepay.PAID, litepay.TEST, litepay.REFUNDED, litepay.PARTIALLY_REFUNDED, litepay.AMOUNT_MISMATCH, litepay.OUT_OF_STOCK)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// MismatchCart records a payment that does not match the amount or currency of the cart
+// and moves the cart to the amount_mismatch status, which blocks the purchase letter.
+// Like PayCart it reports whether this call made the transition.
+func (q *CartQueries) MismatchCart(ctx context.Context, cart *models.Cart) (bool, error) {
+	query := `
+	UPDATE cart 
+	SET payment_id = COALESCE(NULLIF(?, ''), payment_id), payment_status = ?, amount_paid = ?, currency_paid = ?, updated = datetime('now') 
+	WHERE id = ? AND payment_status NOT IN (?, ?, ?, ?, ?, ?)
+`
+	result, err := q.DB.ExecContext(ctx, query, cart.PaymentID, litepay.AMOUNT_MISMATCH, cart.AmountPaid, cart.CurrencyPaid, cart.ID,
+		litepay.PAID, litepay.TEST, litepay.REFUNDED, litepay.PARTIALLY_REFUNDED, litepay.AMOUNT_MISMATCH, litepay.OUT_OF_STOCK)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// RefundCart adds the refunded amount to the cart and updates its payment status.
+// The amount is added only when the cart is still paid and still has the refunded
+// amount read by the caller. Like PayCart it reports whether this call stored the
+// refund, so that a refund reported by the admin and by the payment system is
+// counted once. When the cart is fully refunded, the digital_data keys assigned
+// to it are released.
+func (q *CartQueries) RefundCart(ctx context.Context, cartID string, refunded, amount int, status litepay.Status) (bool, error) {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE cart 
+	SET amount_refunded = amount_refunded + ?, payment_status = ?, updated = datetime('now') 
+	WHERE id = ? AND amount_refunded = ? AND payment_status IN (?, ?, ?, ?)
+`
+	result, err := tx.ExecContext(ctx, query, amount, status, cartID, refunded,
+		litepay.PAID, litepay.TEST, litepay.PARTIALLY_REFUNDED, litepay.OUT_OF_STOCK)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected != 1 {
+		return false, nil
+	}
+
+	if status == litepay.REFUNDED {
+		if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET cart_id = NULL, invoice = NULL WHERE cart_id = ?`, cartID); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// CartPaymentLink returns the link of the page on which the buyer pays the cart
+// again. The link carries a token signed with the secret of the site, so that
+// only the buyer who got the letter can start a new payment of the cart.
+func (q *CartQueries) CartPaymentLink(ctx context.Context, cartID string) (string, error) {
+	setting, err := db.GetSettingByKey(ctx, "domain", "jwt_secret")
+	if err != nil {
+		return "", err
+	}
+
+	token := security.Sign(setting["jwt_secret"].Value.(string), "pay:"+cartID)
+	return fmt.Sprintf("https://%s/cart/%s/pay?token=%s", setting["domain"].Value.(string), cartID, token), nil
+}
+
+// CheckCartPaymentToken reports whether the token was issued by CartPaymentLink for the cart.
+func (q *CartQueries) CheckCartPaymentToken(ctx context.Context, cartID, token string) (bool, error) {
+	setting, err := db.GetSettingByKey(ctx, "jwt_secret")
+	if err != nil {
+		return false, err
+	}
+
+	return security.Verify(setting["jwt_secret"].Value.(string), "pay:"+cartID, token), nil
+}
+
 // CartLetterPayment is ...
 func (q *CartQueries) CartLetterPayment(ctx context.Context, email, amountPayment, paymentURL string) (*models.MessageMail, error) {
 	mailLetter, err := db.GetSettingByKey(ctx, "site_name", "mail_letter_payment")
@@ -228,6 +689,97 @@ func (q *CartQueries) CartLetterPayment(ctx context.Context, email, amountPaymen
 	return mail, nil
 }
 
+// CartLetterInstructions prepares the letter with the instructions of an offline payment.
+// The cart ID is the payment reference.
+func (q *CartQueries) CartLetterInstructions(ctx context.Context, email, amountPayment, cartID, instructions string) (*models.MessageMail, error) {
+	mailLetter, err := db.GetSettingByKey(ctx, "site_name", "mail_letter_instructions")
+	if err != nil {
+		return nil, err
+	}
+	letterTemplate := models.Letter{}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_instructions"].Value.(string)), &letterTemplate); err != nil {
+		return nil, err
+	}
+
+	mail := &models.MessageMail{
+		To:     email,
+		Letter: letterTemplate,
+		Data: map[string]string{
+			"Site_Name":      mailLetter["site_name"].Value.(string),
+			"Amount_Payment": amountPayment,
+			"Cart_ID":        cartID,
+			"Instructions":   instructions,
+		},
+	}
+
+	return mail, nil
+}
+
+// CartLetterMismatch prepares the letter that tells the admin about a payment
+// that does not match its cart.
+func (q *CartQueries) CartLetterMismatch(ctx context.Context, cartID string) (*models.MessageMail, error) {
+	cart, err := q.Cart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	mailLetter, err := db.GetSettingByKey(ctx, "email", "site_name", "mail_letter_mismatch")
+	if err != nil {
+		return nil, err
+	}
+	letterTemplate := models.Letter{}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_mismatch"].Value.(string)), &letterTemplate); err != nil {
+		return nil, err
+	}
+
+	mail := &models.MessageMail{
+		To:     mailLetter["email"].Value.(string),
+		Letter: letterTemplate,
+		Data: map[string]string{
+			"Site_Name":      mailLetter["site_name"].Value.(string),
+			"Cart_ID":        cart.ID,
+			"Customer_Email": cart.Email,
+			"Amount_Cart":    litepay.FormatPrice(cart.AmountTotal, cart.Currency),
+			"Amount_Payment": litepay.FormatPrice(cart.AmountPaid, cart.CurrencyPaid),
+			"Products":       cartLines(cart.Cart),
+		},
+	}
+
+	return mail, nil
+}
+
+// CartLetterOutOfStock prepares the letter that tells the admin about a paid
+// cart whose keys could not be given.
+func (q *CartQueries) CartLetterOutOfStock(ctx context.Context, cartID string) (*models.MessageMail, error) {
+	cart, err := q.Cart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	mailLetter, err := db.GetSettingByKey(ctx, "email", "site_name", "mail_letter_out_of_stock")
+	if err != nil {
+		return nil, err
+	}
+	letterTemplate := models.Letter{}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_out_of_stock"].Value.(string)), &letterTemplate); err != nil {
+		return nil, err
+	}
+
+	mail := &models.MessageMail{
+		To:     mailLetter["email"].Value.(string),
+		Letter: letterTemplate,
+		Data: map[string]string{
+			"Site_Name":      mailLetter["site_name"].Value.(string),
+			"Cart_ID":        cart.ID,
+			"Customer_Email": cart.Email,
+			"Amount_Cart":    litepay.FormatPrice(cart.AmountTotal, cart.Currency),
+			"Products":       cartLines(cart.Cart),
+		},
+	}
+
+	return mail, nil
+}
+
 // CartLetterPurchase is ...
 func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*models.MessageMail, error) {
 	mail := &models.MessageMail{}
@@ -237,8 +789,8 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 	err := q.QueryRowContext(ctx, `
         SELECT email, cart
         FROM cart
-        WHERE payment_status = ? AND id = ?
-    `, litepay.PAID, cartID).Scan(&mail.To, &cartJSON)
+        WHERE payment_status IN (?, ?) AND id = ?
+    `, litepay.PAID, litepay.TEST, cartID).Scan(&mail.To, &cartJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.ErrPageNotFound
@@ -261,14 +813,18 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 
 	keys := []models.Data{}
 	files := []models.File{}
+	keyNames, fileNames := []string{}, []string{}
 	for _, cart := range products {
-		var digitalType string
-		err := tx.QueryRowContext(ctx, `SELECT digital FROM product WHERE id = ?`, cart.ProductID).Scan(&digitalType)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return nil, errors.ErrPageNotFound
+		// carts stored before the snapshot of the products read the product
+		digitalType := cart.DigitalType
+		if digitalType == "" {
+			err := tx.QueryRowContext(ctx, `SELECT digital FROM product WHERE id = ?`, cart.ProductID).Scan(&digitalType)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return nil, errors.ErrPageNotFound
+				}
+				return nil, err
 			}
-			return nil, err
 		}
 
 		switch digitalType {
@@ -284,28 +840,23 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 					return nil, err
 				}
 				files = append(files, file)
+				fileNames = append(fileNames, cart.Name)
 			}
 			rows.Close()
 		case "data":
-			key := models.Data{}
-			err := tx.QueryRowContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id = ?`, cartID).Scan(&key.ID, &key.Content)
+			// a letter sent again delivers the keys the cart already has
+			given, err := cartProductKeys(ctx, tx, cartID, cart.ProductID, unitCount(cart))
 			if err != nil {
-				if err == sql.ErrNoRows {
-					err = tx.QueryRowContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id IS NULL AND product_id = ? LIMIT 1`, cart.ProductID).Scan(&key.ID, &key.Content)
-					if err != nil {
-						if err == sql.ErrNoRows {
-							return nil, errors.ErrPageNotFound
-						}
-						return nil, err
-					}
-					if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET cart_id = ? WHERE id = ?`, cartID, key.ID); err != nil {
-						return nil, err
-					}
-				} else {
-					return nil, err
-				}
+				return nil, err
+			}
+			taken, err := assignKeys(ctx, tx, cartID, cart.ProductID, unitCount(cart)-len(given))
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range append(given, taken...) {
+				keys = append(keys, key)
+				keyNames = append(keyNames, cart.Name)
 			}
-			keys = append(keys, key)
 		}
 	}
 
@@ -318,15 +869,15 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 	count := 1
 	if len(keys) > 0 {
 		purchases.WriteString("Keys:\n")
-		for _, key := range keys {
-			purchases.WriteString(fmt.Sprintf("%v: %s\n", count, key.Content))
+		for i, key := range keys {
+			purchases.WriteString(purchaseLine(count, keyNames[i], key.Content))
 			count++
 		}
 	}
 	if len(files) > 0 {
 		purchases.WriteString("Files:\n")
-		for _, file := range files {
-			purchases.WriteString(fmt.Sprintf("%v: %s\n", count, file.OrigName))
+		for i, file := range files {
+			purchases.WriteString(purchaseLine(count, fileNames[i], file.OrigName))
 			count++
 		}
 	}
@@ -348,3 +899,117 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 
 	return mail, nil
 }
+
+// purchaseLine is a line of the purchases of a letter, the content is named
+// after its product when the cart line has the snapshot of the product.
+func purchaseLine(number int, name, content string) string {
+	if name == "" {
+		return fmt.Sprintf("%v: %s\n", number, content)
+	}
+	return fmt.Sprintf("%v: %s - %s\n", number, name, content)
+}
+
+// cartLines lists the products of the cart for the letters to the admin.
+func cartLines(products []models.CartProduct) string {
+	var lines strings.Builder
+	for _, product := range products {
+		name := product.Name
+		if name == "" {
+			name = product.ProductID
+		}
+		lines.WriteString(fmt.Sprintf("%s x %d", name, product.Quantity))
+		if product.Currency != "" {
+			lines.WriteString(", " + litepay.FormatPrice(product.UnitAmount, product.Currency))
+		}
+		lines.WriteString("\n")
+	}
+	return lines.String()
+}
+
+// unitCount is the number of units of a cart line, carts stored before the
+// quantity was sent have none and hold a single unit.
+func unitCount(product models.CartProduct) int {
+	if product.Quantity < 1 {
+		return 1
+	}
+	return product.Quantity
+}
+
+// cartProductKeys returns up to limit keys of the product given to the cart.
+func cartProductKeys(ctx context.Context, tx *sql.Tx, cartID, productID string, limit int) ([]models.Data, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id = ? AND product_id = ? ORDER BY rowid LIMIT ?`, cartID, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.Data{}
+	for rows.Next() {
+		key := models.Data{CartID: cartID}
+		if err := rows.Scan(&key.ID, &key.Content); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// assignKeys gives count free keys of the product to the cart. Nothing is
+// given when the product has fewer free keys, the transaction is rolled back
+// by the caller.
+func assignKeys(ctx context.Context, tx *sql.Tx, cartID, productID string, count int) ([]models.Data, error) {
+	if count < 1 {
+		return []models.Data{}, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id IS NULL AND product_id = ? ORDER BY rowid LIMIT ?`, productID, count)
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.Data{}
+	for rows.Next() {
+		key := models.Data{CartID: cartID}
+		if err := rows.Scan(&key.ID, &key.Content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) < count {
+		return nil, fmt.Errorf("%w: product %s needs %d, %d left", errors.ErrNotEnoughKeys, productID, count, len(keys))
+	}
+
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET cart_id = ? WHERE id = ?`, cartID, key.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// CartKeys returns the keys given to the cart, in the order they were stored.
+func (q *CartQueries) CartKeys(ctx context.Context, cartID string) ([]models.CartKey, error) {
+	rows, err := q.DB.QueryContext(ctx, `SELECT product_id, content FROM digital_data WHERE cart_id = ? ORDER BY rowid`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.CartKey{}
+	for rows.Next() {
+		key := models.CartKey{}
+		if err := rows.Scan(&key.ProductID, &key.Content); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
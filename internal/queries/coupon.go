@@ -0,0 +1,212 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/security"
+)
+
+// CouponQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through CouponQueries.
+type CouponQueries struct {
+	*sql.DB
+}
+
+// couponColumns is the list of columns scanned by scanCoupon.
+// A coupon is used by every cart with its code that was not canceled or failed.
+const couponColumns = `
+		id,
+		code,
+		type,
+		value,
+		products,
+		max_uses,
+		max_uses_email,
+		strftime('%s', valid_from),
+		strftime('%s', valid_until),
+		active,
+		(SELECT COUNT(*) FROM cart WHERE cart.coupon = coupon.code COLLATE NOCASE AND cart.payment_status NOT IN (?, ?)),
+		strftime('%s', created),
+		strftime('%s', updated)
+`
+
+// scanCoupon reads a coupon selected with couponColumns.
+func scanCoupon(row interface{ Scan(...any) error }) (*models.Coupon, error) {
+	coupon := &models.Coupon{}
+	var products string
+	var validFrom, validUntil, updated sql.NullInt64
+
+	err := row.Scan(
+		&coupon.ID,
+		&coupon.Code,
+		&coupon.Type,
+		&coupon.Value,
+		&products,
+		&coupon.MaxUses,
+		&coupon.MaxUsesEmail,
+		&validFrom,
+		&validUntil,
+		&coupon.Active,
+		&coupon.Uses,
+		&coupon.Created,
+		&updated,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(products), &coupon.Products); err != nil {
+		return nil, err
+	}
+	coupon.ValidFrom = validFrom.Int64
+	coupon.ValidUntil = validUntil.Int64
+	coupon.Updated = updated.Int64
+
+	return coupon, nil
+}
+
+// Coupons retrieves a list of coupons from the database.
+func (q *CouponQueries) Coupons(ctx context.Context) ([]*models.Coupon, error) {
+	coupons := []*models.Coupon{}
+
+	query := `SELECT ` + couponColumns + ` FROM coupon ORDER BY created DESC`
+	rows, err := q.DB.QueryContext(ctx, query, litepay.CANCELED, litepay.FAILED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+// Coupon retrieves a coupon from the database using its ID.
+func (q *CouponQueries) Coupon(ctx context.Context, id string) (*models.Coupon, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupon WHERE id = ?`
+	coupon, err := scanCoupon(q.DB.QueryRowContext(ctx, query, litepay.CANCELED, litepay.FAILED, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// CouponByCode retrieves a coupon from the database using its code, the code is case insensitive.
+func (q *CouponQueries) CouponByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupon WHERE code = ?`
+	coupon, err := scanCoupon(q.DB.QueryRowContext(ctx, query, litepay.CANCELED, litepay.FAILED, code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// IsCouponCode checks if another coupon than the one with the given ID uses the code.
+func (q *CouponQueries) IsCouponCode(ctx context.Context, code, id string) bool {
+	var exists bool
+	err := q.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM coupon WHERE code = ? AND id != ?)`, code, id).Scan(&exists)
+	return err == nil && exists
+}
+
+// CouponEmailUses returns the number of carts of the email that used the coupon code.
+func (q *CouponQueries) CouponEmailUses(ctx context.Context, code, email string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM cart WHERE coupon = ? COLLATE NOCASE AND LOWER(email) = LOWER(?) AND payment_status NOT IN (?, ?)`
+	err := q.DB.QueryRowContext(ctx, query, code, email, litepay.CANCELED, litepay.FAILED).Scan(&count)
+	return count, err
+}
+
+// CartUsesCoupon reports whether the cart counts as a use of the coupon code.
+func (q *CouponQueries) CartUsesCoupon(ctx context.Context, cartID, code string) (bool, error) {
+	var used bool
+	query := `SELECT EXISTS(SELECT 1 FROM cart WHERE id = ? AND coupon = ? COLLATE NOCASE AND payment_status NOT IN (?, ?))`
+	err := q.DB.QueryRowContext(ctx, query, cartID, code, litepay.CANCELED, litepay.FAILED).Scan(&used)
+	return used, err
+}
+
+// AddCoupon inserts a new coupon into the database and returns the created coupon or an error.
+func (q *CouponQueries) AddCoupon(ctx context.Context, coupon *models.Coupon) (*models.Coupon, error) {
+	coupon.ID = security.RandomString()
+
+	products, err := json.Marshal(coupon.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO coupon (
+		id, code, type, value, products, max_uses, max_uses_email, valid_from, valid_until, active
+	) VALUES (?, ?, ?, ?, ?, ?, ?, datetime(NULLIF(?, 0), 'unixepoch'), datetime(NULLIF(?, 0), 'unixepoch'), ?)
+	RETURNING strftime('%s', created)
+`
+	err = q.DB.QueryRowContext(ctx, query,
+		coupon.ID, coupon.Code, coupon.Type, coupon.Value, string(products),
+		coupon.MaxUses, coupon.MaxUsesEmail, coupon.ValidFrom, coupon.ValidUntil, coupon.Active,
+	).Scan(&coupon.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+// UpdateCoupon updates the details of a coupon in the database.
+func (q *CouponQueries) UpdateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	products, err := json.Marshal(coupon.Products)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE coupon SET
+		code = ?,
+		type = ?,
+		value = ?,
+		products = ?,
+		max_uses = ?,
+		max_uses_email = ?,
+		valid_from = datetime(NULLIF(?, 0), 'unixepoch'),
+		valid_until = datetime(NULLIF(?, 0), 'unixepoch'),
+		updated = datetime('now')
+	WHERE id = ?
+`
+	_, err = q.DB.ExecContext(ctx, query,
+		coupon.Code, coupon.Type, coupon.Value, string(products),
+		coupon.MaxUses, coupon.MaxUsesEmail, coupon.ValidFrom, coupon.ValidUntil, coupon.ID,
+	)
+	return err
+}
+
+// DeleteCoupon deletes a coupon from the database. Carts keep the code they were paid with.
+func (q *CouponQueries) DeleteCoupon(ctx context.Context, id string) error {
+	_, err := q.DB.ExecContext(ctx, `DELETE FROM coupon WHERE id = ?`, id)
+	return err
+}
+
+// UpdateCouponActive toggles the active status of a coupon with the given ID.
+func (q *CouponQueries) UpdateCouponActive(ctx context.Context, id string) error {
+	query := `UPDATE coupon SET active = NOT active, updated = datetime('now') WHERE id = ?`
+	_, err := q.DB.ExecContext(ctx, query, id)
+	return err
+}
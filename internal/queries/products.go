@@ -38,6 +38,11 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, idList
 				product.brief,
 				product.slug,
 				product.amount,
+				product.billing,
+				product.billing_interval,
+				product.pay_what_you_want,
+				product.min_amount,
+				product.suggested_amount,
 				product.active,
 				product.digital,
 				EXISTS(SELECT 1 FROM digital_data WHERE digital_data.product_id = product.id AND digital_data.cart_id IS NULL) OR
@@ -83,6 +88,11 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, idList
 			&product.Brief,
 			&product.Slug,
 			&product.Amount,
+			&product.Billing,
+			&product.Interval,
+			&product.PayWhatYouWant,
+			&product.MinAmount,
+			&product.SuggestedAmount,
 			&product.Active,
 			&digitalType,
 			&digitalFilled,
@@ -134,6 +144,11 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 				product.desc, 
 				product.slug, 
 				product.amount,
+				product.billing,
+				product.billing_interval,
+				product.pay_what_you_want,
+				product.min_amount,
+				product.suggested_amount,
 				product.active,
 				product.metadata, 
 				product.attribute, 
@@ -165,6 +180,11 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 			&product.Description,
 			&product.Slug,
 			&product.Amount,
+			&product.Billing,
+			&product.Interval,
+			&product.PayWhatYouWant,
+			&product.MinAmount,
+			&product.SuggestedAmount,
 			&product.Active,
 			&metadata,
 			&attributes,
@@ -222,8 +242,8 @@ func (q *ProductQueries) AddProduct(ctx context.Context, product *models.Product
 
 	query := `
 			INSERT INTO product (
-					id, name, amount, slug, metadata, attribute, brief, desc, digital, active
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, FALSE)
+					id, name, amount, billing, billing_interval, pay_what_you_want, min_amount, suggested_amount, slug, metadata, attribute, brief, desc, digital, active
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, FALSE)
 			RETURNING strftime('%s', created)
 	`
 	stmt, err := q.DB.PrepareContext(ctx, query)
@@ -233,7 +253,8 @@ func (q *ProductQueries) AddProduct(ctx context.Context, product *models.Product
 	defer stmt.Close()
 
 	err = stmt.QueryRowContext(ctx,
-		product.ID, product.Name, product.Amount, product.Slug,
+		product.ID, product.Name, product.Amount, product.Billing, product.Interval,
+		product.PayWhatYouWant, product.MinAmount, product.SuggestedAmount, product.Slug,
 		metadata, attributes, product.Brief, product.Description, product.Digital.Type,
 	).Scan(&product.Created)
 	if err != nil {
@@ -267,6 +288,11 @@ func (q *ProductQueries) UpdateProduct(ctx context.Context, product *models.Prod
 				desc = ?, 
 				slug = ?, 
 				amount = ?, 
+				billing = ?, 
+				billing_interval = ?, 
+				pay_what_you_want = ?, 
+				min_amount = ?, 
+				suggested_amount = ?, 
 				metadata = ?, 
 				attribute = ?, 
 				seo = ?, 
@@ -284,6 +310,11 @@ func (q *ProductQueries) UpdateProduct(ctx context.Context, product *models.Prod
 		product.Description,
 		product.Slug,
 		product.Amount,
+		product.Billing,
+		product.Interval,
+		product.PayWhatYouWant,
+		product.MinAmount,
+		product.SuggestedAmount,
 		metadata,
 		attributes,
 		seo,
@@ -323,6 +354,62 @@ func (q *ProductQueries) IsProduct(ctx context.Context, slug string) bool {
 	return err == nil && exists
 }
 
+// ProductStock returns the number of units of the products that can be sold,
+// keyed by product ID. A product with a file is not limited and has -1 units,
+// a product with data has one unit per unassigned content. Products that are
+// inactive, deleted or do not exist are missing from the map.
+func (q *ProductQueries) ProductStock(ctx context.Context, ids ...string) (map[string]int, error) {
+	stock := map[string]int{}
+	if len(ids) == 0 {
+		return stock, nil
+	}
+
+	params := make([]any, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+
+	query := fmt.Sprintf(`
+			SELECT
+				product.id,
+				EXISTS (
+					SELECT 1 FROM digital_file
+					WHERE digital_file.product_id = product.id
+					AND digital_file.orig_name IS NOT NULL
+				),
+				(
+					SELECT COUNT(*) FROM digital_data
+					WHERE digital_data.product_id = product.id
+					AND digital_data.content IS NOT NULL
+					AND digital_data.cart_id IS NULL
+				)
+			FROM product
+			WHERE product.deleted = 0 AND product.active = 1 AND product.id IN (%s)
+	`, strings.Repeat("?, ", len(ids)-1)+"?")
+
+	rows, err := q.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var file bool
+		var data int
+		if err := rows.Scan(&id, &file, &data); err != nil {
+			return nil, err
+		}
+
+		stock[id] = data
+		if file {
+			stock[id] = -1
+		}
+	}
+
+	return stock, rows.Err()
+}
+
 // UpdateActive toggles the 'active' status of a product and updates its 'updated' timestamp.
 // It takes a context and an ID as arguments, and returns an error if the operation fails.
 func (q *ProductQueries) UpdateActive(ctx context.Context, id string) error {
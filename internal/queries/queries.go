@@ -10,6 +10,10 @@ import (
 
 var db *Base
 
+// DevMode activates the payment systems for testing (litepay.Provider.Dev)
+// without enabling them in the settings.
+var DevMode bool
+
 // Define the structure 'Base' that aggregates various queries related to different modules like
 // settings, authentication, installation, pages, products, and cart management.
 type Base struct {
@@ -19,6 +23,8 @@ type Base struct {
 	PageQueries
 	ProductQueries
 	CartQueries
+	CouponQueries
+	SubscriptionQueries
 }
 
 // New initializes the application's database and returns an error if any occurs during the process.
@@ -37,6 +43,9 @@ func New(embed embed.FS) (err error) {
 		PageQueries:    PageQueries{DB: sqlite},
 		ProductQueries: ProductQueries{DB: sqlite},
 		CartQueries:    CartQueries{DB: sqlite},
+		CouponQueries:  CouponQueries{DB: sqlite},
+
+		SubscriptionQueries: SubscriptionQueries{DB: sqlite},
 	}
 	return
 }
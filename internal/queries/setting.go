@@ -3,12 +3,14 @@ package queries
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/vuisme/litecart/internal/models"
 	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
 	"github.com/vuisme/litecart/pkg/security"
 	"github.com/vuisme/litecart/pkg/strutil"
 )
@@ -50,23 +52,42 @@ func (q *SettingQueries) GroupFieldMap(settings any) map[string]any {
 		return map[string]any{
 			"currency": &s.Currency,
 		}
+	case *models.Tax:
+		return map[string]any{
+			"tax_active":    &s.Active,
+			"tax_inclusive": &s.Inclusive,
+			"tax_country":   &s.Country,
+			"tax_zones":     &s.Zones,
+		}
 	case *models.Stripe:
 		return map[string]any{
-			"stripe_secret_key": &s.SecretKey,
-			"stripe_active":     &s.Active,
+			"stripe_secret_key":      &s.SecretKey,
+			"stripe_webhook_secret":  &s.WebhookSecret,
+			"stripe_mode":            &s.Mode,
+			"stripe_locale":          &s.Locale,
+			"stripe_billing_address": &s.BillingAddress,
+			"stripe_promotion_codes": &s.PromotionCodes,
+			"stripe_active":          &s.Active,
 		}
 	case *models.Paypal:
 		return map[string]any{
 			"paypal_client_id":  &s.ClientID,
 			"paypal_secret_key": &s.SecretKey,
+			"paypal_mode":       &s.Mode,
 			"paypal_active":     &s.Active,
 		}
 	case *models.Spectrocoin:
 		return map[string]any{
-			"spectrocoin_merchant_id": &s.MerchantID,
-			"spectrocoin_project_id":  &s.ProjectID,
-			"spectrocoin_private_key": &s.PrivateKey,
-			"spectrocoin_active":      &s.Active,
+			"spectrocoin_merchant_id":  &s.MerchantID,
+			"spectrocoin_project_id":   &s.ProjectID,
+			"spectrocoin_private_key":  &s.PrivateKey,
+			"spectrocoin_pay_currency": &s.PayCurrency,
+			"spectrocoin_active":       &s.Active,
+		}
+	case *models.Reconcile:
+		return map[string]any{
+			"reconcile_max_age":  &s.MaxAge,
+			"reconcile_cart_ttl": &s.CartTTL,
 		}
 	case *models.Webhook:
 		return map[string]any{
@@ -141,6 +162,11 @@ func (q *SettingQueries) GetSettingByGroup(ctx context.Context, settings any) (a
 					return nil, err
 				}
 				*ptr = iValue
+			default:
+				// lists are stored as JSON
+				if err := json.Unmarshal([]byte(value), ptr); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -167,6 +193,16 @@ func (q *SettingQueries) UpdateSettingByGroup(ctx context.Context, settings any)
 	defer stmt.Close()
 
 	for key, value := range fieldMap {
+		switch value.(type) {
+		case *string, *bool, *int:
+		default:
+			byteValue, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			value = string(byteValue)
+		}
+
 		if _, err = stmt.ExecContext(ctx, value, key); err != nil {
 			return err
 		}
@@ -226,3 +262,85 @@ func (q *SettingQueries) UpdateSettingByKey(ctx context.Context, setting *models
 	_, err := q.DB.ExecContext(ctx, query, setting.Value, setting.Key)
 	return err
 }
+
+// GetPaymentProvider retrieves the settings of a registered payment system.
+// Settings are stored under "<provider>_<key>" keys, missing keys are left empty.
+func (q *SettingQueries) GetPaymentProvider(ctx context.Context, provider litepay.Provider) (*models.PaymentProvider, error) {
+	prefix := string(provider.Name) + "_"
+	setting := &models.PaymentProvider{
+		Name:     provider.Name,
+		Settings: litepay.Settings{},
+	}
+
+	keys := []any{prefix + "active"}
+	for _, field := range provider.Settings {
+		keys = append(keys, prefix+field.Key)
+	}
+
+	query := fmt.Sprintf("SELECT key, value FROM setting WHERE key IN (%s)", strings.Repeat("?, ", len(keys)-1)+"?")
+	rows, err := q.DB.QueryContext(ctx, query, keys...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		key = strings.TrimPrefix(key, prefix)
+		if key == "active" {
+			setting.Active, _ = strconv.ParseBool(value.String)
+			continue
+		}
+		setting.Settings[key] = value.String
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if provider.Dev && DevMode {
+		setting.Active = true
+	}
+
+	return setting, nil
+}
+
+// UpdatePaymentProvider stores the settings of a registered payment system.
+// Keys that are not declared by the provider are ignored, missing rows are created.
+func (q *SettingQueries) UpdatePaymentProvider(ctx context.Context, provider litepay.Provider, setting *models.PaymentProvider) error {
+	prefix := string(provider.Name) + "_"
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO setting (id, key, value) VALUES (?, ?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.ExecContext(ctx, security.RandomString(), prefix+"active", strconv.FormatBool(setting.Active)); err != nil {
+		return err
+	}
+
+	for _, field := range provider.Settings {
+		value, ok := setting.Settings[field.Key]
+		if !ok {
+			continue
+		}
+		if _, err = stmt.ExecContext(ctx, security.RandomString(), prefix+field.Key, value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,343 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/pkg/errors"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/security"
+)
+
+// SubscriptionQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through SubscriptionQueries.
+type SubscriptionQueries struct {
+	*sql.DB
+}
+
+// subscriptionColumns is the list of columns scanned by scanSubscription.
+const subscriptionColumns = `
+		id,
+		cart_id,
+		email,
+		payment_system,
+		subscription_id,
+		customer_id,
+		status,
+		strftime('%s', current_period_end),
+		cancel_at_period_end,
+		renewals,
+		last_invoice,
+		renewal_delivered,
+		strftime('%s', created),
+		strftime('%s', updated)
+`
+
+// scanSubscription reads a subscription selected with subscriptionColumns.
+func scanSubscription(row interface{ Scan(...any) error }) (*models.Subscription, error) {
+	subscription := &models.Subscription{}
+	var periodEnd, updated sql.NullInt64
+
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.CartID,
+		&subscription.Email,
+		&subscription.PaymentSystem,
+		&subscription.SubscriptionID,
+		&subscription.CustomerID,
+		&subscription.Status,
+		&periodEnd,
+		&subscription.CancelAtPeriodEnd,
+		&subscription.Renewals,
+		&subscription.LastInvoice,
+		&subscription.RenewalDelivered,
+		&subscription.Created,
+		&updated,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.CurrentPeriodEnd = periodEnd.Int64
+	subscription.Updated = updated.Int64
+
+	return subscription, nil
+}
+
+// Subscriptions retrieves a list of subscriptions from the database.
+func (q *SubscriptionQueries) Subscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	subscriptions := []*models.Subscription{}
+
+	rows, err := q.DB.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM subscription ORDER BY created DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// Subscription retrieves a subscription from the database using its ID.
+func (q *SubscriptionQueries) Subscription(ctx context.Context, id string) (*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription WHERE id = ?`
+	subscription, err := scanSubscription(q.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// SubscriptionByPaymentID retrieves a subscription from the database using the ID assigned by the payment system.
+func (q *SubscriptionQueries) SubscriptionByPaymentID(ctx context.Context, paymentSystem litepay.PaymentSystem, subscriptionID string) (*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription WHERE payment_system = ? AND subscription_id = ?`
+	subscription, err := scanSubscription(q.DB.QueryRowContext(ctx, query, paymentSystem, subscriptionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// AddSubscription stores the subscription bought with the cart. A subscription
+// that is already stored is left as it is, so that the payment of the cart and
+// the events of the subscription can record it in any order.
+func (q *SubscriptionQueries) AddSubscription(ctx context.Context, cart *models.Cart, subscription *litepay.Subscription) error {
+	query := `
+	INSERT INTO subscription (id, cart_id, email, payment_system, subscription_id, customer_id, status, current_period_end, cancel_at_period_end)
+	VALUES (?, ?, ?, ?, ?, ?, ?, datetime(NULLIF(?, 0), 'unixepoch'), ?)
+	ON CONFLICT (payment_system, subscription_id) DO NOTHING
+`
+	_, err := q.DB.ExecContext(ctx, query,
+		security.RandomString(), cart.ID, cart.Email, cart.PaymentSystem, subscription.ID,
+		subscription.Customer, subscription.Status, subscription.CurrentPeriodEnd, subscription.CancelAtPeriodEnd,
+	)
+	return err
+}
+
+// UpdateSubscription stores the status and the current period of the subscription.
+func (q *SubscriptionQueries) UpdateSubscription(ctx context.Context, subscription *models.Subscription) error {
+	query := `
+	UPDATE subscription
+	SET status = ?, current_period_end = COALESCE(datetime(NULLIF(?, 0), 'unixepoch'), current_period_end), cancel_at_period_end = ?, updated = datetime('now')
+	WHERE id = ?
+`
+	_, err := q.DB.ExecContext(ctx, query, subscription.Status, subscription.CurrentPeriodEnd, subscription.CancelAtPeriodEnd, subscription.ID)
+	return err
+}
+
+// RenewSubscription counts the renewal paid by the invoice and gives the
+// recurring products of the cart fresh digital_data keys for the new period,
+// one per unit, in one transaction. It reports whether this call recorded the
+// invoice, so that the renewal is counted only once when the payment system
+// repeats the notification. The renewal stays undelivered until RenewalDelivered.
+func (q *SubscriptionQueries) RenewSubscription(ctx context.Context, id, invoice string) (bool, error) {
+	subscription, err := q.Subscription(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE subscription
+	SET last_invoice = ?, renewals = renewals + 1, renewal_delivered = FALSE, updated = datetime('now')
+	WHERE id = ? AND last_invoice != ?
+`
+	result, err := tx.ExecContext(ctx, query, invoice, id, invoice)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected != 1 {
+		return false, nil
+	}
+
+	products, err := recurringProducts(ctx, tx, subscription.CartID)
+	if err != nil {
+		return false, err
+	}
+	for _, product := range products {
+		if product.DigitalType != "data" {
+			continue
+		}
+		keys, err := assignKeys(ctx, tx, subscription.CartID, product.ProductID, unitCount(product))
+		if err != nil {
+			return false, err
+		}
+		for _, key := range keys {
+			if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET invoice = ? WHERE id = ?`, invoice, key.ID); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// RenewalDelivered records that the letter of the renewal paid by the invoice was sent.
+func (q *SubscriptionQueries) RenewalDelivered(ctx context.Context, id, invoice string) error {
+	_, err := q.DB.ExecContext(ctx, `UPDATE subscription SET renewal_delivered = TRUE WHERE id = ? AND last_invoice = ?`, id, invoice)
+	return err
+}
+
+// recurringProducts returns the recurring products of the cart with their current digital type.
+// One-off products of the cart were delivered with the purchase.
+func recurringProducts(ctx context.Context, tx *sql.Tx, cartID string) ([]models.CartProduct, error) {
+	var cartJSON string
+	err := tx.QueryRowContext(ctx, `SELECT cart FROM cart WHERE id = ?`, cartID).Scan(&cartJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrCartNotFound
+		}
+		return nil, err
+	}
+
+	products := []models.CartProduct{}
+	if err := json.Unmarshal([]byte(cartJSON), &products); err != nil {
+		return nil, err
+	}
+
+	recurring := []models.CartProduct{}
+	for _, product := range products {
+		var billing string
+		err := tx.QueryRowContext(ctx, `SELECT digital, billing FROM product WHERE id = ?`, product.ProductID).Scan(&product.DigitalType, &billing)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errors.ErrProductNotFound
+			}
+			return nil, err
+		}
+		if billing == models.BillingRecurring {
+			recurring = append(recurring, product)
+		}
+	}
+
+	return recurring, nil
+}
+
+// SubscriptionLetterRenewal prepares the letter of the last renewal. It delivers
+// the recurring products of the cart again, with the keys given for the renewal.
+func (q *SubscriptionQueries) SubscriptionLetterRenewal(ctx context.Context, id string) (*models.MessageMail, error) {
+	subscription, err := q.Subscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	products, err := recurringProducts(ctx, tx, subscription.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []models.Data{}
+	files := []models.File{}
+	keyNames, fileNames := []string{}, []string{}
+	for _, cart := range products {
+		switch cart.DigitalType {
+		case "file":
+			rows, err := tx.QueryContext(ctx, `SELECT id, name, ext, orig_name FROM digital_file WHERE product_id = ?`, cart.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				file := models.File{}
+				if err := rows.Scan(&file.ID, &file.Name, &file.Ext, &file.OrigName); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				files = append(files, file)
+				fileNames = append(fileNames, cart.Name)
+			}
+			rows.Close()
+		case "data":
+			rows, err := tx.QueryContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id = ? AND product_id = ? AND invoice = ? ORDER BY rowid`, subscription.CartID, cart.ProductID, subscription.LastInvoice)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				key := models.Data{CartID: subscription.CartID}
+				if err := rows.Scan(&key.ID, &key.Content); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				keys = append(keys, key)
+				keyNames = append(keyNames, cart.Name)
+			}
+			rows.Close()
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var purchases strings.Builder
+	count := 1
+	if len(keys) > 0 {
+		purchases.WriteString("Keys:\n")
+		for i, key := range keys {
+			purchases.WriteString(purchaseLine(count, keyNames[i], key.Content))
+			count++
+		}
+	}
+	if len(files) > 0 {
+		purchases.WriteString("Files:\n")
+		for i, file := range files {
+			purchases.WriteString(purchaseLine(count, fileNames[i], file.OrigName))
+			count++
+		}
+	}
+
+	mailLetter, err := db.GetSettingByKey(ctx, "email", "site_name", "mail_letter_renewal")
+	if err != nil {
+		return nil, err
+	}
+
+	mail := &models.MessageMail{
+		To:    subscription.Email,
+		Files: files,
+		Data: map[string]string{
+			"Site_Name":   mailLetter["site_name"].Value.(string),
+			"Purchases":   purchases.String(),
+			"Admin_Email": mailLetter["email"].Value.(string),
+		},
+	}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_renewal"].Value.(string)), &mail.Letter); err != nil {
+		return nil, err
+	}
+
+	return mail, nil
+}
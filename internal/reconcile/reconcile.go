@@ -0,0 +1,196 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/vuisme/litecart/internal/checkout"
+	"github.com/vuisme/litecart/internal/models"
+	"github.com/vuisme/litecart/internal/queries"
+	"github.com/vuisme/litecart/internal/webhook"
+	"github.com/vuisme/litecart/pkg/litepay"
+	"github.com/vuisme/litecart/pkg/logging"
+)
+
+// Interval is the time between two reconciliation runs.
+const Interval = 5 * time.Minute
+
+// Start runs the reconciliation of pending carts every Interval until ctx is done.
+func Start(ctx context.Context) {
+	log := logging.New()
+
+	go func() {
+		ticker := time.NewTicker(Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := Run(ctx); err != nil {
+					log.ErrorStack(err)
+				}
+			}
+		}
+	}()
+}
+
+// Run asks the payment systems for the real status of pending carts younger than
+// the configured age and cancels the unpaid carts older than the cart TTL. Carts
+// whose payment is processed are not canceled.
+func Run(ctx context.Context) error {
+	db := queries.DB()
+	log := logging.New()
+
+	setting, err := queries.GetSettingByGroup[models.Reconcile](ctx, db)
+	if err != nil {
+		return err
+	}
+	maxAge := time.Duration(setting.MaxAge) * time.Hour
+	cartTTL := time.Duration(setting.CartTTL) * time.Hour
+
+	carts, err := db.PendingCarts(ctx)
+	if err != nil {
+		return err
+	}
+
+	providers := map[litepay.PaymentSystem]*models.PaymentProvider{}
+	for _, cart := range carts {
+		age := time.Since(time.Unix(cart.Created, 0))
+
+		payment := &litepay.Payment{
+			MerchantID:  cart.PaymentID,
+			AmountTotal: cart.AmountTotal,
+			Currency:    cart.Currency,
+			Status:      cart.PaymentStatus,
+		}
+		if age < maxAge && cart.PaymentID != "" {
+			checked, err := checkCart(ctx, db, providers, cart)
+			if err != nil {
+				log.Warn().Err(err).Str("cart_id", cart.ID).Msg("reconcile cart")
+			} else if checked != nil {
+				payment = checked
+			}
+		}
+
+		// a processed payment is still in flight and is left to its payment
+		// system, an open session is closed before its cart is canceled
+		switch payment.Status {
+		case litepay.NEW, litepay.UNPAID, litepay.FAILED:
+			if age > cartTTL {
+				if err := expireCart(ctx, db, providers, cart); err != nil {
+					log.Warn().Err(err).Str("cart_id", cart.ID).Msg("expire cart")
+					continue
+				}
+				payment.Status = litepay.CANCELED
+			}
+		}
+
+		if payment.Status == cart.PaymentStatus {
+			continue
+		}
+
+		if err := updateCart(ctx, cart, payment); err != nil {
+			log.ErrorStack(err)
+		}
+	}
+
+	return nil
+}
+
+// client returns the client of the payment system of the cart, or nil when
+// the payment system is unknown or not active.
+func client(ctx context.Context, db *queries.Base, providers map[litepay.PaymentSystem]*models.PaymentProvider, cart *models.Cart) (litepay.LitePay, *models.PaymentProvider, error) {
+	provider, ok := litepay.Lookup(cart.PaymentSystem)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	setting, ok := providers[provider.Name]
+	if !ok {
+		var err error
+		setting, err = db.GetPaymentProvider(ctx, provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		providers[provider.Name] = setting
+	}
+
+	if !setting.Active {
+		return nil, nil, nil
+	}
+
+	return provider.New(litepay.New("", "", ""), setting.Settings), setting, nil
+}
+
+// expireCart closes the session of the cart at payment systems that can close
+// sessions. It fails when the session was paid meanwhile.
+func expireCart(ctx context.Context, db *queries.Base, providers map[litepay.PaymentSystem]*models.PaymentProvider, cart *models.Cart) error {
+	if cart.PaymentID == "" {
+		return nil
+	}
+
+	pay, _, err := client(ctx, db, providers, cart)
+	if err != nil {
+		return err
+	}
+
+	expirer, ok := pay.(litepay.Expirer)
+	if !ok {
+		return nil
+	}
+
+	return expirer.Expire(&litepay.Payment{
+		CartID:        cart.ID,
+		MerchantID:    cart.PaymentID,
+		PaymentSystem: cart.PaymentSystem,
+	})
+}
+
+// checkCart returns the payment of the cart as seen by its payment system,
+// or nil when the payment system can not be asked.
+func checkCart(ctx context.Context, db *queries.Base, providers map[litepay.PaymentSystem]*models.PaymentProvider, cart *models.Cart) (*litepay.Payment, error) {
+	pay, setting, err := client(ctx, db, providers, cart)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciler, ok := pay.(litepay.Reconciler)
+	if !ok {
+		return nil, nil
+	}
+
+	payment, err := reconciler.Reconcile(&litepay.Payment{
+		CartID:        cart.ID,
+		MerchantID:    cart.PaymentID,
+		AmountTotal:   cart.AmountTotal,
+		Currency:      cart.Currency,
+		PaymentSystem: cart.PaymentSystem,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payment.Status = setting.SandboxStatus(payment.Status)
+
+	return payment, nil
+}
+
+// updateCart stores the payment of the cart and sends the webhook of the change.
+func updateCart(ctx context.Context, cart *models.Cart, payment *litepay.Payment) error {
+	changed, err := checkout.UpdatePayment(ctx, cart, payment)
+	// the cart was completed by a notification in the meantime
+	if err != nil || !changed {
+		return err
+	}
+
+	hook := checkout.PaymentHook(webhook.PAYMENT_CALLBACK, cart, payment)
+	switch {
+	case payment.Status.Paid():
+		hook.Event = webhook.PAYMENT_SUCCESS
+	case payment.Status == litepay.CANCELED:
+		hook.Event = webhook.PAYMENT_CANCEL
+	}
+
+	return webhook.SendPaymentHook(hook)
+}
@@ -12,6 +12,7 @@ func ApiPrivateRoutes(c *fiber.App) {
 	c.Post("/api/install", handlers.Install)
 
 	c.Get("/api/_/version", middleware.JWTProtected(), handlers.Version)
+	c.Get("/api/_/sandbox", middleware.JWTProtected(), handlers.Sandbox)
 
 	sign := c.Group("/api/sign")
 	sign.Post("/in", handlers.SignIn)
@@ -49,8 +50,25 @@ func ApiPrivateRoutes(c *fiber.App) {
 	product.Post("/:product_id<len(15)>/image", handlers.AddProductImage)
 	product.Delete("/:product_id<len(15)>/image/:image_id<len(15)>", handlers.DeleteProductImage)
 
+	// coupons
+	coupons := c.Group("/api/_/coupons", middleware.JWTProtected())
+	coupons.Get("/", handlers.Coupons)
+	coupons.Post("/", handlers.AddCoupon)
+	coupons.Get("/:coupon_id<len(15)>", handlers.Coupon)
+	coupons.Patch("/:coupon_id<len(15)>", handlers.UpdateCoupon)
+	coupons.Delete("/:coupon_id<len(15)>", handlers.DeleteCoupon)
+	coupons.Patch("/:coupon_id<len(15)>/active", handlers.UpdateCouponActive)
+
 	// carts
 	carts := c.Group("/api/_/carts", middleware.JWTProtected())
 	carts.Get("/", handlers.Carts)
 	carts.Post("/:cart_id<len(15)>/mail", handlers.CartSendMail)
+	carts.Post("/:cart_id<len(15)>/payment-link", handlers.CartSendPaymentLink)
+	carts.Post("/:cart_id<len(15)>/paid", handlers.CartPaid)
+	carts.Post("/:cart_id<len(15)>/refund", handlers.CartRefund)
+
+	// subscriptions
+	subscriptions := c.Group("/api/_/subscriptions", middleware.JWTProtected())
+	subscriptions.Get("/", handlers.Subscriptions)
+	subscriptions.Post("/:subscription_id<len(15)>/cancel", handlers.CancelSubscription)
 }
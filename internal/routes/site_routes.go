@@ -32,9 +32,14 @@ func SiteRoutes(c *fiber.App) {
 		return c.Render("cart", nil, "layouts/main")
 	})
 
+	c.Get("/cart/:cart_id<len(15)>/pay", handlers.PaymentLink)
+	c.Post("/cart/:cart_id<len(15)>/pay", handlers.PaymentRenew)
+
 	payment := c.Group("/cart/payment")
 	payment.Post("/", handlers.Payment)
 	payment.Post("/callback", handlers.PaymentCallback)
 	payment.Get("/success", handlers.PaymentSuccess)
 	payment.Get("/cancel", handlers.PaymentCancel)
+	payment.Get("/mock", handlers.PaymentMock)
+	payment.Post("/mock", handlers.PaymentMockResult)
 }
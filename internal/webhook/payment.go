@@ -18,7 +18,13 @@ const (
 	PAYMENT_CALLBACK   Event = "payment_callback"
 	PAYMENT_SUCCESS    Event = "payment_success"
 	PAYMENT_CANCEL     Event = "payment_cancel"
+	PAYMENT_REFUND     Event = "payment_refund"
 	PAYMENT_ERROR      Event = "payment_error"
+
+	SUBSCRIPTION_RENEWAL Event = "subscription_renewal"
+	// SUBSCRIPTION_REVOKE is sent when the buyer loses access to a subscription,
+	// it was canceled or its renewal was not paid.
+	SUBSCRIPTION_REVOKE Event = "subscription_revoke"
 )
 
 type Payment struct {
@@ -31,9 +37,15 @@ type Data struct {
 	CartID        string                `json:"cart_id,omitempty"`
 	PaymentSystem litepay.PaymentSystem `json:"payment_system"`
 	PaymentStatus litepay.Status        `json:"payment_status"`
-	TotalAmount   int                   `json:"total_amount,omitempty"`
+	TotalAmount   int                   `json:"total_amount"`
+	Discount      int                   `json:"discount,omitempty"` // of the coupon and of the payment system, sent when the cart is paid
+	RefundAmount  int                   `json:"refund_amount,omitempty"`
 	Currency      string                `json:"currency,omitempty"`
 	CartItems     []litepay.Item        `json:"cart_items,omitempty"`
+	Keys          []models.CartKey      `json:"keys,omitempty"` // delivered with the purchase, sent when the cart is paid
+
+	SubscriptionID     string                     `json:"subscription_id,omitempty"`
+	SubscriptionStatus litepay.SubscriptionStatus `json:"subscription_status,omitempty"`
 }
 
 // SendPaymentHook is ...
@@ -49,6 +61,17 @@ func SendPaymentHook(resData *Payment) error {
 	}
 
 	if webhookSetting.Url != "" {
+		// the keys were given to the cart by the purchase letter, the payment
+		// systems that notify the shop report the payment as a callback
+		paymentEvent := resData.Event == PAYMENT_SUCCESS || resData.Event == PAYMENT_CALLBACK
+		if paymentEvent && resData.Data.PaymentStatus.Paid() && resData.Data.CartID != "" {
+			keys, err := db.CartKeys(ctx, resData.Data.CartID)
+			if err != nil {
+				return err
+			}
+			resData.Data.Keys = keys
+		}
+
 		jsonData, err := json.Marshal(resData)
 		if err != nil {
 			return err
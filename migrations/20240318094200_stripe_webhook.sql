@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('wD4m7SkqT1cZb8e', 'stripe_webhook_secret', '');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'wD4m7SkqT1cZb8e';
+-- +goose StatementEnd
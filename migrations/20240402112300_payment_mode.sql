@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('Rk5vH0aPq2XzL7m', 'paypal_mode', 'sandbox');
+INSERT INTO setting SELECT 'c8YwN3tJf6UeB1s', 'stripe_mode', CASE WHEN value LIKE '%\_live\_%' ESCAPE '\' THEN 'live' ELSE 'sandbox' END FROM setting WHERE key = 'stripe_secret_key';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'c8YwN3tJf6UeB1s';
+DELETE FROM setting WHERE id = 'Rk5vH0aPq2XzL7m';
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('pX3nV8cLq5RtY2w', 'reconcile_max_age', '48');
+INSERT INTO setting VALUES ('hJ7bK1mZs9GdF4e', 'reconcile_cart_ttl', '24');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('pX3nV8cLq5RtY2w', 'hJ7bK1mZs9GdF4e');
+-- +goose StatementEnd
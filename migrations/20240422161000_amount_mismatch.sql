@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE cart ADD COLUMN "amount_paid" NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE cart ADD COLUMN "currency_paid" TEXT NOT NULL DEFAULT "";
+INSERT INTO setting VALUES ('mT6qW2xNc8ZsE4r', 'mail_letter_mismatch', '{"subject":"Payment does not match the cart","text":"Hello,\nA payment on the [{{.Site_Name}}] website does not match the cart and the purchase was not sent to the customer.\n\nCart: {{.Cart_ID}}\nCustomer: {{.Customer_Email}}\nAmount of the cart: {{.Amount_Cart}}\nAmount paid: {{.Amount_Payment}}\n\nPlease review the cart in the admin panel.","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'mT6qW2xNc8ZsE4r';
+ALTER TABLE cart DROP COLUMN "currency_paid";
+ALTER TABLE cart DROP COLUMN "amount_paid";
+-- +goose StatementEnd
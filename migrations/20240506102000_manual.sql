@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('nB5vR9kWe2TqY7u', 'manual_active', 'false');
+INSERT INTO setting VALUES ('sG3cH8mLp4XaJ1d', 'manual_instructions', '');
+INSERT INTO setting VALUES ('wQ9fZ2tNy6KbV3s', 'mail_letter_instructions', '{"subject":"Payment instructions","text":"Hello,\nThank you for your order on the [{{.Site_Name}}] website.\n\nAmount payment: {{.Amount_Payment}}\nPayment reference: {{.Cart_ID}}\n\n{{.Instructions}}\n\nPlease put the payment reference in the transfer details. Your purchase will be sent to you as soon as the payment is received.\n\nBest regards,","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('nB5vR9kWe2TqY7u', 'sG3cH8mLp4XaJ1d', 'wQ9fZ2tNy6KbV3s');
+-- +goose StatementEnd
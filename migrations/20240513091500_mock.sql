@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('yL4dE7rTb1NcW9k', 'mock_active', 'false');
+INSERT INTO setting VALUES ('aV8sK3pXm6HqZ2j', 'mock_secret', lower(hex(randomblob(32))));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('yL4dE7rTb1NcW9k', 'aV8sK3pXm6HqZ2j');
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE coupon (
+	id              TEXT PRIMARY KEY NOT NULL,
+	code            TEXT UNIQUE NOT NULL COLLATE NOCASE,
+	type            TEXT NOT NULL CHECK (type == 'percent' OR type == 'fixed'),
+	value           NUMERIC NOT NULL,
+	products        JSON DEFAULT '[]' NOT NULL,
+	max_uses        NUMERIC NOT NULL DEFAULT 0,
+	max_uses_email  NUMERIC NOT NULL DEFAULT 0,
+	valid_from      TIMESTAMP DEFAULT NULL,
+	valid_until     TIMESTAMP DEFAULT NULL,
+	active          BOOLEAN DEFAULT TRUE NOT NULL,
+	created         TIMESTAMP DEFAULT (datetime('now')),
+	updated         TIMESTAMP
+);
+CREATE INDEX idx_coupon_code ON coupon (code);
+ALTER TABLE cart ADD COLUMN "coupon" TEXT NOT NULL DEFAULT "";
+ALTER TABLE cart ADD COLUMN "amount_discount" NUMERIC NOT NULL DEFAULT 0;
+CREATE INDEX idx_cart_coupon ON cart (coupon);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_cart_coupon;
+ALTER TABLE cart DROP COLUMN "amount_discount";
+ALTER TABLE cart DROP COLUMN "coupon";
+DROP TABLE coupon;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('m8VSSLG8twtaG6P', 'tax_active', 'false');
+INSERT INTO setting VALUES ('ksxYNBeIMGP2tJ1', 'tax_inclusive', 'false');
+INSERT INTO setting VALUES ('2do2Mk92cqaozBk', 'tax_country', '');
+INSERT INTO setting VALUES ('otk81Oi7xmWLCJR', 'tax_zones', '[]');
+ALTER TABLE cart ADD COLUMN "amount_tax" NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE cart ADD COLUMN "tax" JSON DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE cart DROP COLUMN "tax";
+ALTER TABLE cart DROP COLUMN "amount_tax";
+DELETE FROM setting WHERE id IN ('m8VSSLG8twtaG6P', 'ksxYNBeIMGP2tJ1', '2do2Mk92cqaozBk', 'otk81Oi7xmWLCJR');
+-- +goose StatementEnd
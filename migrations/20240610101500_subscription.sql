@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN "billing" TEXT NOT NULL DEFAULT 'one_off' CHECK (billing == 'one_off' OR billing == 'recurring');
+ALTER TABLE product ADD COLUMN "billing_interval" TEXT NOT NULL DEFAULT "";
+CREATE TABLE subscription (
+	id                    TEXT PRIMARY KEY NOT NULL,
+	cart_id               TEXT NOT NULL,
+	email                 TEXT NOT NULL DEFAULT "",
+	payment_system        TEXT NOT NULL,
+	subscription_id       TEXT NOT NULL,
+	customer_id           TEXT NOT NULL DEFAULT "",
+	status                TEXT NOT NULL,
+	current_period_end    TIMESTAMP DEFAULT NULL,
+	cancel_at_period_end  BOOLEAN DEFAULT FALSE NOT NULL,
+	last_invoice          TEXT NOT NULL DEFAULT "",
+	renewals              NUMERIC NOT NULL DEFAULT 0,
+	created               TIMESTAMP DEFAULT (datetime('now')),
+	updated               TIMESTAMP,
+	UNIQUE (payment_system, subscription_id)
+);
+CREATE INDEX idx_subscription_cart_id ON subscription (cart_id);
+INSERT INTO setting VALUES ('rE7vB3nQx9TkW5m', 'mail_letter_renewal', '{"subject":"Your subscription has been renewed","text":"Hello,\nYour subscription on the [{{.Site_Name}}] website has been renewed.\n\nHere is your content for the new period:\n\n{{.Purchases}}\n\nIf you have any questions, please contact us {{.Admin_Email}}.\n\nBest regards,","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'rE7vB3nQx9TkW5m';
+DROP TABLE subscription;
+ALTER TABLE product DROP COLUMN "billing_interval";
+ALTER TABLE product DROP COLUMN "billing";
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN "pay_what_you_want" BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product ADD COLUMN "min_amount" NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE product ADD COLUMN "suggested_amount" NUMERIC NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE product DROP COLUMN "suggested_amount";
+ALTER TABLE product DROP COLUMN "min_amount";
+ALTER TABLE product DROP COLUMN "pay_what_you_want";
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('kT5wQn8cVb2LpXe', 'stripe_locale', 'auto');
+INSERT INTO setting VALUES ('Hy3mRf9sJd6ZaUq', 'stripe_billing_address', 'false');
+INSERT INTO setting VALUES ('pN7xEc4gWt1KvMb', 'stripe_promotion_codes', 'false');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('kT5wQn8cVb2LpXe', 'Hy3mRf9sJd6ZaUq', 'pN7xEc4gWt1KvMb');
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('hT6vQ2nWk8RzL4c', 'btcpay_active', 'false');
+INSERT INTO setting VALUES ('pE3xM9bGs5YdK1f', 'btcpay_server_url', '');
+INSERT INTO setting VALUES ('uJ7kD4cVr2NwH8q', 'btcpay_store_id', '');
+INSERT INTO setting VALUES ('zB1sF6tXe9PmA3g', 'btcpay_api_key', '');
+INSERT INTO setting VALUES ('kR5wN8yCq3LjU7d', 'btcpay_webhook_secret', '');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('hT6vQ2nWk8RzL4c', 'pE3xM9bGs5YdK1f', 'uJ7kD4cVr2NwH8q', 'zB1sF6tXe9PmA3g', 'kR5wN8yCq3LjU7d');
+-- +goose StatementEnd
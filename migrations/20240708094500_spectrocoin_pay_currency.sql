@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('dW8qT3mZr6KvB1x', 'spectrocoin_pay_currency', 'BTC');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'dW8qT3mZr6KvB1x';
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE subscription ADD COLUMN "renewal_delivered" BOOLEAN DEFAULT TRUE NOT NULL;
+ALTER TABLE digital_data ADD COLUMN "invoice" TEXT DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE digital_data DROP COLUMN "invoice";
+ALTER TABLE subscription DROP COLUMN "renewal_delivered";
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('kP3sN8vXw2QzR7d', 'mail_letter_out_of_stock', '{"subject":"Paid cart is out of stock","text":"Hello,\nA cart on the [{{.Site_Name}}] website was paid, but there are not enough keys left and the purchase was not sent to the customer.\n\nCart: {{.Cart_ID}}\nCustomer: {{.Customer_Email}}\nAmount of the cart: {{.Amount_Cart}}\nProducts: {{.Products}}\n\nPlease add keys and mark the cart as paid, or refund it in the admin panel.","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'kP3sN8vXw2QzR7d';
+-- +goose StatementEnd
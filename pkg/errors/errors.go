@@ -13,6 +13,13 @@ const (
 	MsgProductNotFound = "product not found"
 	MsgPageNotFound    = "page not found"
 	MsgSettingNotFound = "setting not found"
+	MsgCartNotFound    = "cart not found"
+	MsgCouponNotFound  = "coupon not found"
+	MsgCouponLimit     = "coupon usage limit reached"
+
+	MsgSubscriptionNotFound = "subscription not found"
+
+	MsgNotEnoughKeys = "not enough keys left"
 )
 
 var (
@@ -26,4 +33,16 @@ var (
 	ErrProductNotFound = errors.New(MsgProductNotFound)
 	ErrPageNotFound    = errors.New(MsgPageNotFound)
 	ErrSettingNotFound = errors.New(MsgSettingNotFound)
+	ErrCartNotFound    = errors.New(MsgCartNotFound)
+	ErrCouponNotFound  = errors.New(MsgCouponNotFound)
+	ErrCouponLimit     = errors.New(MsgCouponLimit)
+
+	ErrSubscriptionNotFound = errors.New(MsgSubscriptionNotFound)
+
+	ErrNotEnoughKeys = errors.New(MsgNotEnoughKeys)
 )
+
+// Is reports whether any error in err's tree matches target.
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
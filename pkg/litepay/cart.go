@@ -1,21 +1,67 @@
 package litepay
 
-import validation "github.com/go-ozzo/ozzo-validation/v4"
+import (
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
 
 type Cart struct {
 	ID       string `json:"id"`
+	Email    string `json:"email,omitempty"` // email of the buyer, prefilled on the payment page
 	Currency string `json:"currency"`
 	Items    []Item `json:"items"`
+	Locale   string `json:"locale,omitempty"` // language of the buyer ("de", "pt-BR"), payment pages are shown in it when they can be
+}
+
+// AmountTotal returns the amount the buyer pays for the cart, taxes included.
+func (v Cart) AmountTotal() int {
+	var amount int
+	for _, item := range v.Items {
+		amount += item.Amount()
+	}
+	return amount
+}
+
+// AmountTax returns the tax charged on top of the item prices.
+func (v Cart) AmountTax() int {
+	var amount int
+	for _, line := range taxLines(v.Items) {
+		amount += line.Amount
+	}
+	return amount
+}
+
+// Intervals returns the distinct billing intervals of the recurring items.
+func (v Cart) Intervals() []string {
+	intervals := []string{}
+	for _, item := range v.Items {
+		if item.PriceData.Recurring != nil && !findInSlice(intervals, item.PriceData.Recurring.Interval) {
+			intervals = append(intervals, item.PriceData.Recurring.Interval)
+		}
+	}
+	return intervals
 }
 
 type Item struct {
 	PriceData Price `json:"price"`
 	Quantity  int   `json:"quantity"`
+	Tax       *Tax  `json:"tax,omitempty"`
+}
+
+// Amount returns the amount of the line, with the tax charged on top of the price.
+func (v Item) Amount() int {
+	amount := v.PriceData.UnitAmount * v.Quantity
+	if v.Tax != nil && !v.Tax.Inclusive {
+		amount += v.Tax.Amount
+	}
+	return amount
 }
 
 type Price struct {
-	UnitAmount int     `json:"init_amount"`
-	Product    Product `json:"product"`
+	UnitAmount int        `json:"init_amount"`
+	Product    Product    `json:"product"`
+	Recurring  *Recurring `json:"recurring,omitempty"`
 }
 
 type Product struct {
@@ -25,14 +71,18 @@ type Product struct {
 }
 
 type Payment struct {
-	PaymentSystem PaymentSystem `json:"provider"`
-	MerchantID    string        `json:"merchant_id"`
-	CartID        string        `json:"cart_id"`
-	AmountTotal   int           `json:"amount_total"`
-	Currency      string        `json:"currency"`
-	Status        Status        `json:"status"`
-	URL           string        `json:"url,omitempty"`
-	Coin          *Coin         `json:"coin,omitempty"`
+	PaymentSystem  PaymentSystem `json:"provider"`
+	MerchantID     string        `json:"merchant_id"`
+	CartID         string        `json:"cart_id"`
+	AmountTotal    int           `json:"amount_total"`
+	AmountRefunded int           `json:"amount_refunded,omitempty"`
+	AmountDiscount int           `json:"amount_discount,omitempty"` // discount granted by the payment system, e.g. a Stripe promotion code
+	Currency       string        `json:"currency"`
+	Status         Status        `json:"status"`
+	URL            string        `json:"url,omitempty"`
+	Instructions   string        `json:"instructions,omitempty"` // how to pay offline, sent to the buyer
+	Coin           *Coin         `json:"coin,omitempty"`
+	Subscription   *Subscription `json:"subscription,omitempty"` // the subscription started or changed by the payment
 }
 
 // Validate is ...
@@ -42,6 +92,12 @@ func (v Payment) Validate() error {
 	)
 }
 
+// Match reports whether the payment was made for the amount and currency of the cart.
+// A discount granted by the payment system counts as paid.
+func (v Payment) Match(amountTotal int, currency string) bool {
+	return v.AmountTotal+v.AmountDiscount == amountTotal && strings.EqualFold(v.Currency, currency)
+}
+
 type Coin struct {
 	AmountTotal float64 `json:"amount_total"`
 	Currency    string  `json:"currency"`
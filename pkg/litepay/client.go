@@ -0,0 +1,93 @@
+package litepay
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultClient is used when Cfg has no client, it keeps a slow payment
+// system from blocking the checkout.
+var defaultClient = &http.Client{Timeout: 20 * time.Second}
+
+// defaultRetry repeats idempotent requests twice.
+var defaultRetry = Retry{Attempts: 3, Wait: 500 * time.Millisecond}
+
+// Retry is the policy for repeating idempotent requests (GET, HEAD and requests
+// with an Idempotency-Key header) that failed with a network error or a 5xx
+// response. Attempts counts the first request, Wait doubles after every attempt.
+type Retry struct {
+	Attempts int
+	Wait     time.Duration
+}
+
+// WithClient sets the HTTP client the payment systems are called with.
+func (c Cfg) WithClient(client *http.Client) Cfg {
+	c.client = client
+	return c
+}
+
+// WithBaseURL replaces the API address of the payment system, for example
+// with an httptest server.
+func (c Cfg) WithBaseURL(paymentSystem PaymentSystem, baseURL string) Cfg {
+	baseURLs := make(map[PaymentSystem]string, len(c.baseURL)+1)
+	for name, url := range c.baseURL {
+		baseURLs[name] = url
+	}
+	baseURLs[paymentSystem] = baseURL
+	c.baseURL = baseURLs
+	return c
+}
+
+// WithRetry sets the retry policy for idempotent requests.
+func (c Cfg) WithRetry(retry Retry) Cfg {
+	c.retry = retry
+	return c
+}
+
+// apiURL returns the API address of the payment system, api unless it is overridden.
+func (c Cfg) apiURL(api string) string {
+	if baseURL, ok := c.baseURL[c.paymentSystem]; ok {
+		return baseURL
+	}
+	return api
+}
+
+// do sends the request with the client of Cfg and repeats it according to the retry policy.
+func (c Cfg) do(req *http.Request) (*http.Response, error) {
+	client := c.client
+	if client == nil {
+		client = defaultClient
+	}
+
+	attempts := 1
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead || req.Header.Get("Idempotency-Key") != ""
+	if idempotent && (req.Body == nil || req.GetBody != nil) && c.retry.Attempts > 1 {
+		attempts = c.retry.Attempts
+	}
+
+	wait := c.retry.Wait
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= attempts || (err == nil && resp.StatusCode < 500) {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
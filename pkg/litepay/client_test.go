@@ -0,0 +1,70 @@
+package litepay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_do(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithClient(server.Client()).WithRetry(Retry{Attempts: 3, Wait: time.Millisecond})
+
+	// idempotent requests are repeated
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := cfg.do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// other requests are sent once
+	calls.Store(0)
+	req, _ = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("a=1"))
+	resp, err = cfg.do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// requests with an idempotency key are repeated with their body
+	calls.Store(0)
+	req, _ = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("a=1"))
+	req.Header.Set("Idempotency-Key", "key")
+	resp, err = cfg.do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func Test_WithBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/checkout/sessions/cs_test_1", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"cs_test_1","payment_intent":"pi_1","amount_total":1500,"currency":"eur","payment_status":"paid"}`))
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithClient(server.Client()).WithBaseURL(STRIPE, server.URL)
+	payment, err := cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{}).Checkout(&Payment{CartID: "cart00000000001"}, "cs_test_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "pi_1", payment.MerchantID)
+	assert.Equal(t, 1500, payment.AmountTotal)
+	assert.Equal(t, "EUR", payment.Currency)
+	assert.Equal(t, PAID, payment.Status)
+
+	// the override belongs to one payment system
+	assert.Equal(t, "https://api.paypal.com", cfg.Paypal("id", "secret", LIVE).(*paypal).api)
+}
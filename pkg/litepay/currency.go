@@ -0,0 +1,48 @@
+package litepay
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minorUnits lists the ISO 4217 currencies whose minor unit is not 1/100.
+// Amounts in litepay are integers in the minor unit of their currency.
+var minorUnits = map[string]int{
+	// zero-decimal currencies
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	// three-decimal currencies
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	// four-decimal currencies
+	"CLF": 4, "UYW": 4,
+}
+
+// MinorUnits returns the number of decimal digits of the currency minor unit.
+func MinorUnits(currency string) int {
+	if digits, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// ToMajor converts an amount in minor units to the major unit of the currency.
+func ToMajor(amount int, currency string) float64 {
+	return float64(amount) / math.Pow10(MinorUnits(currency))
+}
+
+// ToMinor converts an amount in the major unit of the currency to minor units.
+func ToMinor(amount float64, currency string) int {
+	return int(math.Round(amount * math.Pow10(MinorUnits(currency))))
+}
+
+// FormatAmount formats an amount in minor units with the decimal digits of
+// the currency, as payment system APIs expect it ("10.50", "1500", "1.250").
+func FormatAmount(amount int, currency string) string {
+	return strconv.FormatFloat(ToMajor(amount, currency), 'f', MinorUnits(currency), 64)
+}
+
+// FormatPrice formats an amount in minor units with its currency code for people ("10.50 USD").
+func FormatPrice(amount int, currency string) string {
+	return FormatAmount(amount, currency) + " " + strings.ToUpper(currency)
+}
@@ -0,0 +1,227 @@
+package litepay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_currency(t *testing.T) {
+	cases := []struct {
+		currency string
+		digits   int
+		amount   int
+		format   string
+		price    string
+	}{
+		{"JPY", 0, 1500, "1500", "1500 JPY"},
+		{"usd", 2, 1999, "19.99", "19.99 USD"},
+		{"KWD", 3, 12345, "12.345", "12.345 KWD"},
+	}
+
+	for _, tt := range cases {
+		assert.Equal(t, tt.digits, MinorUnits(tt.currency))
+		assert.Equal(t, tt.format, FormatAmount(tt.amount, tt.currency))
+		assert.Equal(t, tt.price, FormatPrice(tt.amount, tt.currency))
+		assert.Equal(t, tt.amount, ToMinor(ToMajor(tt.amount, tt.currency), tt.currency))
+	}
+	assert.Equal(t, 1999, ToMinor(19.99, "USD"))
+}
+
+func Test_PaypalCurrency(t *testing.T) {
+	cases := []struct {
+		currency string
+		value    string
+		amount   int
+	}{
+		{"JPY", "3000", 3000},
+		{"USD", "30.00", 3000},
+		{"KWD", "3.000", 3000},
+	}
+
+	for _, tt := range cases {
+		var order struct {
+			PurchaseUnits []struct {
+				Amount struct {
+					Value string `json:"value"`
+				} `json:"amount"`
+			} `json:"purchase_units"`
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/oauth2/token":
+				fmt.Fprint(w, `{"access_token":"token"}`)
+			case "/v2/checkout/orders":
+				json.NewDecoder(r.Body).Decode(&order)
+				fmt.Fprint(w, `{"id":"ORDER1","status":"PAYER_ACTION_REQUIRED","links":[{"rel":"payer-action","href":"https://paypal.com/pay"}]}`)
+			case "/v2/checkout/orders/ORDER1/capture":
+				fmt.Fprintf(w, `{"id":"ORDER1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"amount":{"currency_code":"%s","value":"%s"}}]}}]}`, tt.currency, tt.value)
+			}
+		}))
+
+		provider := New("", "", "").WithBaseURL(PAYPAL, server.URL).Paypal("id", "secret", SANDBOX).(*paypal)
+		provider.currency = []string{tt.currency}
+
+		payment, err := provider.Pay(Cart{
+			ID:       "cart00000000001",
+			Currency: tt.currency,
+			Items:    []Item{{PriceData: Price{UnitAmount: 1500}, Quantity: 2}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+		assert.Equal(t, tt.value, order.PurchaseUnits[0].Amount.Value)
+
+		payment, err = provider.Checkout(&Payment{CartID: "cart00000000001"}, "ORDER1")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+
+		server.Close()
+	}
+}
+
+func Test_SpectrocoinCurrency(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+
+	cases := []struct {
+		currency string
+		value    string
+		amount   int
+	}{
+		{"JPY", "3050", 3050},
+		{"USD", "30.5", 3050},
+		{"KWD", "3.05", 3050},
+	}
+
+	for _, tt := range cases {
+		var receiveAmount string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			form, _ := url.ParseQuery(string(body))
+			receiveAmount = form.Get("receiveAmount")
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"receiveAmount":"%s","receiveCurrency":"%s","redirectUrl":"https://spectrocoin.com/pay"}`, receiveAmount, tt.currency)
+		}))
+
+		provider := New("", "", "").WithBaseURL(SPECTROCOIN, server.URL).Spectrocoin("merchant", "project", string(privKeyPem), "").(*spectrocoin)
+		provider.currency = []string{tt.currency}
+
+		payment, err := provider.Pay(Cart{
+			ID:       "cart00000000001",
+			Currency: tt.currency,
+			Items:    []Item{{PriceData: Price{UnitAmount: 1525}, Quantity: 2}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.value, receiveAmount)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+
+		server.Close()
+	}
+}
+
+func Test_StripeCurrency(t *testing.T) {
+	cases := []struct {
+		currency string
+		amount   int
+	}{
+		{"JPY", 3000},
+		{"USD", 3000},
+		{"KWD", 3000},
+	}
+
+	for _, tt := range cases {
+		var form url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			form, _ = url.ParseQuery(string(body))
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/checkout/sessions":
+				fmt.Fprintf(w, `{"id":"cs_1","amount_total":%d,"currency":"%s","payment_status":"unpaid","url":"https://stripe.com/pay"}`, tt.amount, tt.currency)
+			case "/v1/checkout/sessions/cs_1":
+				fmt.Fprintf(w, `{"id":"cs_1","payment_intent":"pi_1","amount_total":%d,"currency":"%s","payment_status":"paid"}`, tt.amount, tt.currency)
+			}
+		}))
+
+		provider := New("", "", "").WithBaseURL(STRIPE, server.URL).Stripe("sk_test_key", SANDBOX, StripeCheckout{}).(*stripe)
+		provider.currency = []string{tt.currency}
+
+		// stripe takes the amounts in the minor unit of every currency
+		payment, err := provider.Pay(Cart{
+			ID:       "cart00000000001",
+			Currency: tt.currency,
+			Items:    []Item{{PriceData: Price{UnitAmount: 1500}, Quantity: 2}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "1500", form.Get("line_items[0][price_data][unit_amount]"))
+		assert.Equal(t, tt.currency, form.Get("line_items[0][price_data][currency]"))
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+
+		payment, err = provider.Checkout(&Payment{CartID: "cart00000000001"}, "cs_1")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+		assert.True(t, payment.Match(3000, tt.currency))
+
+		server.Close()
+	}
+}
+
+func Test_BTCPayCurrency(t *testing.T) {
+	cases := []struct {
+		currency string
+		value    string
+		amount   int
+	}{
+		{"JPY", "3050", 3050},
+		{"USD", "30.50", 3050},
+		{"KWD", "3.050", 3050},
+	}
+
+	for _, tt := range cases {
+		var invoice struct {
+			Amount   string `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/v1/stores/store1/invoices":
+				json.NewDecoder(r.Body).Decode(&invoice)
+				fmt.Fprintf(w, `{"id":"INV1","status":"New","amount":"%s","currency":"%s","checkoutLink":"https://btcpay.test/i/INV1"}`, invoice.Amount, invoice.Currency)
+			case "/api/v1/stores/store1/invoices/INV1":
+				fmt.Fprintf(w, `{"id":"INV1","status":"New","amount":"%s","currency":"%s"}`, tt.value, tt.currency)
+			}
+		}))
+
+		provider := New("", "", "").BTCPay(server.URL, "store1", "api_key")
+
+		payment, err := provider.Pay(Cart{
+			ID:       "cart00000000001",
+			Currency: tt.currency,
+			Items:    []Item{{PriceData: Price{UnitAmount: 1525}, Quantity: 2}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.value, invoice.Amount)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+
+		payment, err = provider.(Reconciler).Reconcile(&Payment{CartID: "cart00000000001", MerchantID: "INV1"})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+		assert.Equal(t, tt.currency, payment.Currency)
+
+		server.Close()
+	}
+}
@@ -0,0 +1,49 @@
+package litepay
+
+// DiscountItems spreads the discount over the eligible items in proportion to
+// their amounts. A line whose discounted amount can not be divided by its
+// quantity is split in two lines whose unit amounts differ by one minor unit,
+// so that the payment system charges exactly the discounted total. Recurring
+// items are never discounted, their price would be charged on every renewal.
+func DiscountItems(items []Item, eligible []bool, discount int) []Item {
+	eligible = append([]bool(nil), eligible...)
+	var eligibleAmount int
+	for i, item := range items {
+		if item.PriceData.Recurring != nil {
+			eligible[i] = false
+		}
+		if eligible[i] {
+			eligibleAmount += item.PriceData.UnitAmount * item.Quantity
+		}
+	}
+
+	result := make([]Item, 0, len(items))
+	var cumulative, applied int
+	for i, item := range items {
+		if !eligible[i] || eligibleAmount == 0 {
+			result = append(result, item)
+			continue
+		}
+
+		amount := item.PriceData.UnitAmount * item.Quantity
+		cumulative += amount
+		share := discount*cumulative/eligibleAmount - applied
+		applied += share
+
+		amount -= share
+		unit, rest := amount/item.Quantity, amount%item.Quantity
+		item.PriceData.UnitAmount = unit
+		if rest == 0 {
+			result = append(result, item)
+			continue
+		}
+
+		extra := item
+		extra.PriceData.UnitAmount = unit + 1
+		extra.Quantity = rest
+		item.Quantity -= rest
+		result = append(result, item, extra)
+	}
+
+	return result
+}
@@ -0,0 +1,56 @@
+package litepay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiscountItems(t *testing.T) {
+	type line struct {
+		unit     int
+		quantity int
+	}
+
+	cases := []struct {
+		name     string
+		items    []line
+		eligible []bool
+		discount int
+		result   []line
+		total    int
+	}{
+		{"one line", []line{{1000, 1}}, []bool{true}, 100, []line{{900, 1}}, 900},
+		{"split line", []line{{1000, 3}}, []bool{true}, 100, []line{{966, 1}, {967, 2}}, 2900},
+		{"proportional", []line{{1000, 1}, {3000, 1}}, []bool{true, true}, 1000, []line{{750, 1}, {2250, 1}}, 3000},
+		{"rounding", []line{{100, 1}, {100, 1}, {100, 1}}, []bool{true, true, true}, 100, []line{{67, 1}, {67, 1}, {66, 1}}, 200},
+		{"not eligible", []line{{1000, 1}, {500, 2}}, []bool{true, false}, 333, []line{{667, 1}, {500, 2}}, 1667},
+		{"whole amount", []line{{999, 2}, {1, 1}}, []bool{true, true}, 1999, []line{{0, 2}, {0, 1}}, 0},
+		{"nothing eligible", []line{{1000, 1}}, []bool{false}, 100, []line{{1000, 1}}, 1000},
+	}
+
+	for _, tt := range cases {
+		items := make([]Item, len(tt.items))
+		for i, l := range tt.items {
+			items[i] = Item{PriceData: Price{UnitAmount: l.unit}, Quantity: l.quantity}
+		}
+
+		discounted := DiscountItems(items, tt.eligible, tt.discount)
+
+		result := make([]line, len(discounted))
+		for i, item := range discounted {
+			result[i] = line{item.PriceData.UnitAmount, item.Quantity}
+		}
+		assert.Equal(t, tt.result, result, tt.name)
+		assert.Equal(t, tt.total, Cart{Items: discounted}.AmountTotal(), tt.name)
+	}
+
+	// the price of a subscription is charged on every renewal and is never discounted
+	items := []Item{
+		{PriceData: Price{UnitAmount: 1000, Recurring: &Recurring{Interval: "month"}}, Quantity: 1},
+		{PriceData: Price{UnitAmount: 1000}, Quantity: 1},
+	}
+	discounted := DiscountItems(items, []bool{true, true}, 100)
+	assert.Equal(t, 1000, discounted[0].PriceData.UnitAmount)
+	assert.Equal(t, 900, discounted[1].PriceData.UnitAmount)
+}
@@ -47,6 +47,31 @@ func signMessage(message, privKey string) (string, error) {
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
+func verifyMessage(message, sign, pubKey string) error {
+	block, _ := pem.Decode([]byte(pubKey))
+	if block == nil {
+		return errors.New("invalid public key")
+	}
+
+	parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	publicKey, ok := parsedKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("key is not a valid RSA public key")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	hash := sha1.Sum([]byte(message))
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA1, hash[:], signature)
+}
+
 func parseBody(r io.Reader) (map[string]any, error) {
 	var data map[string]any
 
@@ -84,6 +109,7 @@ func StatusPayment(system PaymentSystem, status string) Status {
 			"requires_capture":        PROCESSED,
 			"canceled":                CANCELED,
 			"succeeded":               PAID,
+			"no_payment_required":     PAID,
 		}
 
 	case PAYPAL:
@@ -105,6 +131,15 @@ func StatusPayment(system PaymentSystem, status string) Status {
 			"5": FAILED,    // expired, Payment was not received in time
 			"6": TEST,      // test, Test order
 		}
+
+	case BTCPAY:
+		statusBase = map[string]Status{
+			"New":        UNPAID,    // waiting for a payment
+			"Processing": PROCESSED, // paid in full, waiting for confirmations
+			"Settled":    PAID,      // paid in full and confirmed, or marked as settled
+			"Expired":    CANCELED,  // not paid in time, a partial payment is kept in BTCPay Server
+			"Invalid":    FAILED,    // not confirmed in time, or marked as invalid
+		}
 	}
 
 	statusTmp := statusBase[status]
@@ -114,3 +149,19 @@ func StatusPayment(system PaymentSystem, status string) Status {
 
 	return statusTmp
 }
+
+func refundStatus(payment *Payment, amount int) Status {
+	if amount < payment.AmountTotal {
+		return PARTIALLY_REFUNDED
+	}
+	return REFUNDED
+}
+
+// truncate cuts the text to at most max characters.
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
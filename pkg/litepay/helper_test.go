@@ -59,6 +59,40 @@ func Test_signMessage(t *testing.T) {
 	}
 }
 
+func Test_verifyMessage(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKey8Bytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKey8Pem := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privKey8Bytes,
+	})
+	pubKeyBytes, _ := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	pubKeyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubKeyBytes,
+	})
+
+	sign, err := signMessage("Hello, World!", string(privKey8Pem))
+	assert.NoError(t, err)
+
+	cases := []struct {
+		message string
+		sign    string
+		pubKey  string
+		err     bool
+	}{
+		{"Hello, World!", sign, string(pubKeyPem), false},
+		{"Hello, World?", sign, string(pubKeyPem), true},
+		{"Hello, World!", "not base64!", string(pubKeyPem), true},
+		{"Hello, World!", sign, "", true},
+	}
+
+	for _, tt := range cases {
+		err := verifyMessage(tt.message, tt.sign, tt.pubKey)
+		assert.Equal(t, tt.err, err != nil)
+	}
+}
+
 func Test_parseBody(t *testing.T) {
 	cases := []struct {
 		body     string
@@ -1,17 +1,48 @@
 package litepay
 
+import (
+	"errors"
+	"net/http"
+)
+
 type Status string
 
 const (
-	NEW       Status = "new"
-	UNPAID    Status = "unpaid"
-	PAID      Status = "paid"
-	CANCELED  Status = "canceled"
-	FAILED    Status = "failed"
-	PROCESSED Status = "processed"
-	TEST      Status = "test"
+	NEW                Status = "new"
+	UNPAID             Status = "unpaid"
+	PAID               Status = "paid"
+	CANCELED           Status = "canceled"
+	FAILED             Status = "failed"
+	PROCESSED          Status = "processed"
+	TEST               Status = "test"
+	REFUNDED           Status = "refunded"
+	PARTIALLY_REFUNDED Status = "partially_refunded"
+	AMOUNT_MISMATCH    Status = "amount_mismatch"
+	AWAITING_PAYMENT   Status = "awaiting_payment"
+	OUT_OF_STOCK       Status = "out_of_stock"
+)
+
+// Paid reports whether the payment was completed, TEST marks payments made in a sandbox.
+func (s Status) Paid() bool {
+	return s == PAID || s == TEST
+}
+
+// Mode selects between the test and the production environment of a payment system.
+type Mode string
+
+const (
+	SANDBOX Mode = "sandbox"
+	LIVE    Mode = "live"
 )
 
+// ErrRefundUnsupported is returned by providers that cannot refund payments through their API.
+var ErrRefundUnsupported = errors.New("refund is not supported by this payment system")
+
+// ErrProviderUnavailable is wrapped by the errors of a callback that could not
+// be checked because the payment system did not answer. Unlike a callback that
+// is rejected, the notification should be sent again.
+var ErrProviderUnavailable = errors.New("payment system is not available")
+
 type Cfg struct {
 	paymentSystem PaymentSystem
 	api           string   // API path
@@ -19,11 +50,31 @@ type Cfg struct {
 	callbackURL   string
 	successURL    string
 	cancelURL     string
+
+	client  *http.Client
+	baseURL map[PaymentSystem]string // API address overrides
+	retry   Retry
 }
 
 type LitePay interface {
 	Pay(cart Cart) (*Payment, error)
 	Checkout(payment *Payment, session string) (*Payment, error)
+	// Refund returns amount (in minor units) of the payment to the buyer.
+	// payment.AmountTotal is the amount still available for refund.
+	Refund(payment *Payment, amount int) (*Payment, error)
+}
+
+// Reconciler is implemented by providers that can report the current state
+// of a payment created by Pay. payment.MerchantID holds the ID returned by Pay.
+type Reconciler interface {
+	Reconcile(payment *Payment) (*Payment, error)
+}
+
+// Expirer is implemented by providers whose payment sessions can be closed
+// before they are paid, so that a replaced session can not be paid anymore.
+// payment.MerchantID holds the ID returned by Pay.
+type Expirer interface {
+	Expire(payment *Payment) error
 }
 
 func New(callbackURL, successURL, cancelURL string) Cfg {
@@ -31,5 +82,7 @@ func New(callbackURL, successURL, cancelURL string) Cfg {
 		callbackURL: callbackURL,
 		successURL:  successURL,
 		cancelURL:   cancelURL,
+		client:      defaultClient,
+		retry:       defaultRetry,
 	}
 }
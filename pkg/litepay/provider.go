@@ -6,4 +6,8 @@ const (
 	STRIPE      PaymentSystem = "stripe"
 	PAYPAL      PaymentSystem = "paypal"
 	SPECTROCOIN PaymentSystem = "spectrocoin"
+	BTCPAY      PaymentSystem = "btcpay"
+	MANUAL      PaymentSystem = "manual"
+	MOCK        PaymentSystem = "mock"
+	FREE        PaymentSystem = "free" // carts with a total of 0, not a registered provider
 )
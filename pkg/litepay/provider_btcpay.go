@@ -0,0 +1,337 @@
+package litepay
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BTCPaySignatureHeader carries the signature of a BTCPay Server webhook.
+const BTCPaySignatureHeader = "BTCPay-Sig"
+
+func init() {
+	Register(Provider{
+		Name:  BTCPAY,
+		Title: "BTCPay Server",
+		Settings: []Setting{
+			{Key: "server_url", Title: "Server URL", Required: true},
+			{Key: "store_id", Title: "Store ID", Required: true},
+			{Key: "api_key", Title: "API key", Secret: true, Required: true},
+			{Key: "webhook_secret", Title: "Webhook secret", Secret: true, Required: true},
+		},
+		New: func(c Cfg, settings Settings) LitePay {
+			return c.BTCPay(settings["server_url"], settings["store_id"], settings["api_key"])
+		},
+		Callback: btcpayCallback,
+	})
+}
+
+// CallbackBTCPay is a webhook event sent by BTCPay Server. The event does not
+// carry the amount, it is read from the invoice.
+type CallbackBTCPay struct {
+	DeliveryID   string `json:"deliveryId"`
+	WebhookID    string `json:"webhookId"`
+	IsRedelivery bool   `json:"isRedelivery"`
+	Type         string `json:"type"`
+	Timestamp    int64  `json:"timestamp"`
+	StoreID      string `json:"storeId"`
+	InvoiceID    string `json:"invoiceId"`
+}
+
+// btcpayInvoice is an invoice of the Greenfield API.
+type btcpayInvoice struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	AdditionalStatus string `json:"additionalStatus"`
+	Amount           string `json:"amount"`
+	Currency         string `json:"currency"`
+	CheckoutLink     string `json:"checkoutLink"`
+	Metadata         struct {
+		OrderID string `json:"orderId"`
+	} `json:"metadata"`
+}
+
+// btcpayPaymentMethod is a payment method of an invoice, the amounts are in the coin of the method.
+type btcpayPaymentMethod struct {
+	CryptoCode        string `json:"cryptoCode"` // Greenfield API 1.x
+	Currency          string `json:"currency"`   // Greenfield API 2.x
+	PaymentMethodPaid string `json:"paymentMethodPaid"`
+}
+
+type btcpay struct {
+	Cfg
+	storeID string
+	apiKey  string
+}
+
+// BTCPay uses the Greenfield API of a self-hosted BTCPay Server. The rates
+// of the store decide which currencies can be paid, so any currency is sent.
+func (c Cfg) BTCPay(serverURL, storeID, apiKey string) LitePay {
+	c.paymentSystem = BTCPAY
+	c.api = c.apiURL(strings.TrimRight(serverURL, "/"))
+	return &btcpay{
+		Cfg:     c,
+		storeID: storeID,
+		apiKey:  apiKey,
+	}
+}
+
+func (c *btcpay) Pay(cart Cart) (*Payment, error) {
+	currency := strings.ToUpper(cart.Currency)
+
+	names := []string{}
+	for _, item := range cart.Items {
+		names = append(names, item.PriceData.Product.Name)
+	}
+
+	metadata := map[string]any{
+		"orderId":  cart.ID,
+		"itemDesc": truncate(strings.Join(names, ", "), 255),
+	}
+	if cart.Email != "" {
+		metadata["buyerEmail"] = cart.Email
+	}
+
+	invoiceJson, err := json.Marshal(map[string]any{
+		"amount":   FormatAmount(cart.AmountTotal(), currency),
+		"currency": currency,
+		"metadata": metadata,
+		"checkout": map[string]any{
+			"redirectURL":           fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.successURL, c.paymentSystem, cart.ID),
+			"redirectAutomatically": true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/api/v1/stores/%s/invoices", c.api, c.storeID),
+		bytes.NewBuffer(invoiceJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "token "+c.apiKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("btcpay server returned status %d", resp.StatusCode)
+	}
+
+	invoice := &btcpayInvoice{}
+	if err := json.NewDecoder(resp.Body).Decode(invoice); err != nil {
+		return nil, err
+	}
+
+	checkout := c.payment(invoice)
+	checkout.URL = invoice.CheckoutLink
+
+	return checkout, nil
+}
+
+// Checkout returns the payment of the invoice given as the session.
+func (c *btcpay) Checkout(payment *Payment, session string) (*Payment, error) {
+	checked := *payment
+	checked.MerchantID = session
+	return c.Reconcile(&checked)
+}
+
+// Refund is not supported, a BTCPay refund is a pull payment that the buyer
+// claims with a wallet address, it is made in the BTCPay Server.
+func (c *btcpay) Refund(payment *Payment, amount int) (*Payment, error) {
+	return nil, ErrRefundUnsupported
+}
+
+func (c *btcpay) Reconcile(payment *Payment) (*Payment, error) {
+	invoice, err := c.invoice(payment.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	checked := c.payment(invoice)
+	if err := c.coin(checked); err != nil {
+		return nil, err
+	}
+
+	reconciled := *payment
+	reconciled.AmountTotal = checked.AmountTotal
+	reconciled.Currency = checked.Currency
+	reconciled.Status = checked.Status
+	reconciled.Coin = checked.Coin
+
+	return &reconciled, nil
+}
+
+// invoice fetches the invoice from the store.
+func (c *btcpay) invoice(id string) (*btcpayInvoice, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s/api/v1/stores/%s/invoices/%s", c.api, c.storeID, id),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "token "+c.apiKey)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, errors.New("btcpay invoice not found")
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("btcpay server returned status %d", resp.StatusCode)
+	}
+
+	invoice := &btcpayInvoice{}
+	if err := json.NewDecoder(resp.Body).Decode(invoice); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// payment converts the invoice into a payment. A settled invoice was paid in
+// full, BTCPay Server does not settle an invoice that is paid partially.
+func (c *btcpay) payment(invoice *btcpayInvoice) *Payment {
+	amount, _ := strconv.ParseFloat(invoice.Amount, 64)
+	return &Payment{
+		PaymentSystem: c.paymentSystem,
+		MerchantID:    invoice.ID,
+		CartID:        invoice.Metadata.OrderID,
+		AmountTotal:   ToMinor(amount, invoice.Currency),
+		Currency:      strings.ToUpper(invoice.Currency),
+		Status:        StatusPayment(BTCPAY, invoice.Status),
+	}
+}
+
+// coin records the amount received by the invoice in the coin it was paid with.
+// Nothing is recorded while the invoice has not received a payment.
+func (c *btcpay) coin(payment *Payment) error {
+	if payment.Status != PROCESSED && payment.Status != PAID {
+		return nil
+	}
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s/api/v1/stores/%s/invoices/%s/payment-methods", c.api, c.storeID, payment.MerchantID),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "token "+c.apiKey)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("btcpay server returned status %d", resp.StatusCode)
+	}
+
+	methods := []btcpayPaymentMethod{}
+	if err := json.NewDecoder(resp.Body).Decode(&methods); err != nil {
+		return err
+	}
+
+	// on-chain and lightning payments of the same coin are added up
+	for _, method := range methods {
+		paid, _ := strconv.ParseFloat(method.PaymentMethodPaid, 64)
+		if paid == 0 {
+			continue
+		}
+
+		currency := method.CryptoCode
+		if currency == "" {
+			currency = method.Currency
+		}
+		if payment.Coin == nil {
+			payment.Coin = &Coin{Currency: currency}
+		}
+		if payment.Coin.Currency == currency {
+			payment.Coin.AmountTotal += paid
+		}
+	}
+
+	return nil
+}
+
+// VerifyCallbackBTCPay checks the HMAC-SHA256 signature of a webhook body,
+// the header holds "sha256=" followed by the hex encoded signature.
+func VerifyCallbackBTCPay(body []byte, signature, secret string) (*CallbackBTCPay, error) {
+	if secret == "" {
+		return nil, errors.New("btcpay webhook secret is not configured")
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return nil, errors.New("invalid btcpay signature header")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(decoded, mac.Sum(nil)) {
+		return nil, errors.New("btcpay signature mismatch")
+	}
+
+	callback := &CallbackBTCPay{}
+	if err := json.Unmarshal(body, callback); err != nil {
+		return nil, err
+	}
+
+	return callback, nil
+}
+
+// btcpayCallback converts a signed BTCPay Server webhook into the payment of its invoice.
+func btcpayCallback(settings Settings, header http.Header, body []byte) (*Payment, error) {
+	callback, err := VerifyCallbackBTCPay(body, header.Get(BTCPaySignatureHeader), settings["webhook_secret"])
+	if err != nil {
+		return nil, err
+	}
+
+	switch callback.Type {
+	case "InvoiceReceivedPayment", "InvoicePaymentSettled", "InvoiceProcessing",
+		"InvoiceSettled", "InvoiceExpired", "InvoiceInvalid":
+	default:
+		return nil, nil
+	}
+
+	if callback.StoreID != settings["store_id"] {
+		return nil, errors.New("btcpay webhook of another store")
+	}
+
+	client := New("", "", "").BTCPay(settings["server_url"], settings["store_id"], settings["api_key"]).(*btcpay)
+	invoice, err := client.invoice(callback.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := client.payment(invoice)
+	if err := client.coin(payment); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
@@ -0,0 +1,104 @@
+package litepay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func btcpayServer(t *testing.T, status string, invoice *map[string]any) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token api_key", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/stores/store1/invoices":
+			body, _ := io.ReadAll(r.Body)
+			assert.NoError(t, json.Unmarshal(body, invoice))
+			fmt.Fprint(w, `{"id":"INV1","status":"New","amount":"12.50","currency":"EUR","checkoutLink":"https://btcpay.test/i/INV1","metadata":{"orderId":"cart00000000001"}}`)
+		case "/api/v1/stores/store1/invoices/INV1":
+			fmt.Fprintf(w, `{"id":"INV1","status":"%s","amount":"12.50","currency":"EUR","metadata":{"orderId":"cart00000000001"}}`, status)
+		case "/api/v1/stores/store1/invoices/INV1/payment-methods":
+			fmt.Fprint(w, `[{"cryptoCode":"BTC","paymentMethodPaid":"0.0002"},{"cryptoCode":"BTC","paymentMethodPaid":"0.0001"},{"cryptoCode":"LTC","paymentMethodPaid":"0"}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func Test_BTCPayPay(t *testing.T) {
+	invoice := map[string]any{}
+	server := btcpayServer(t, "Settled", &invoice)
+	defer server.Close()
+
+	cfg := New("https://shop.test/cart/payment/callback", "https://shop.test/cart/payment/success", "")
+	payment, err := cfg.BTCPay(server.URL+"/", "store1", "api_key").Pay(Cart{
+		ID:       "cart00000000001",
+		Email:    "buyer@mail.com",
+		Currency: "eur",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1250, Product: Product{Name: "Ebook"}}, Quantity: 1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "INV1", payment.MerchantID)
+	assert.Equal(t, "https://btcpay.test/i/INV1", payment.URL)
+	assert.Equal(t, UNPAID, payment.Status)
+	assert.Equal(t, 1250, payment.AmountTotal)
+
+	assert.Equal(t, "12.50", invoice["amount"])
+	assert.Equal(t, "EUR", invoice["currency"])
+	assert.Equal(t, map[string]any{"orderId": "cart00000000001", "itemDesc": "Ebook", "buyerEmail": "buyer@mail.com"}, invoice["metadata"])
+	assert.Equal(t, "https://shop.test/cart/payment/success/?payment_system=btcpay&cart_id=cart00000000001", invoice["checkout"].(map[string]any)["redirectURL"])
+
+	reconciled, err := cfg.BTCPay(server.URL, "store1", "api_key").(Reconciler).Reconcile(&Payment{CartID: "cart00000000001", MerchantID: "INV1"})
+	assert.NoError(t, err)
+	assert.Equal(t, PAID, reconciled.Status)
+	assert.True(t, reconciled.Match(1250, "EUR"))
+	assert.Equal(t, "BTC", reconciled.Coin.Currency)
+	assert.InDelta(t, 0.0003, reconciled.Coin.AmountTotal, 1e-9)
+}
+
+func Test_BTCPayCallback(t *testing.T) {
+	server := btcpayServer(t, "Expired", nil)
+	defer server.Close()
+
+	settings := Settings{"server_url": server.URL, "store_id": "store1", "api_key": "api_key", "webhook_secret": "secret"}
+	sign := func(body string) http.Header {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		header := http.Header{}
+		header.Set(BTCPaySignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		return header
+	}
+
+	body := `{"type":"InvoiceExpired","storeId":"store1","invoiceId":"INV1"}`
+	payment, err := btcpayCallback(settings, sign(body), []byte(body))
+	assert.NoError(t, err)
+	assert.Equal(t, "cart00000000001", payment.CartID)
+	assert.Equal(t, CANCELED, payment.Status)
+	assert.Nil(t, payment.Coin)
+
+	// the notification does not concern a payment
+	created := `{"type":"InvoiceCreated","storeId":"store1","invoiceId":"INV1"}`
+	payment, err = btcpayCallback(settings, sign(created), []byte(created))
+	assert.NoError(t, err)
+	assert.Nil(t, payment)
+
+	other := `{"type":"InvoiceSettled","storeId":"store2","invoiceId":"INV1"}`
+	_, err = btcpayCallback(settings, sign(other), []byte(other))
+	assert.Error(t, err)
+
+	_, err = btcpayCallback(settings, sign(body), []byte(`{"type":"InvoiceSettled","storeId":"store1","invoiceId":"INV1"}`))
+	assert.Error(t, err)
+
+	_, err = btcpayCallback(Settings{"store_id": "store1"}, sign(body), []byte(body))
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package litepay
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register(Provider{
+		Name:  MANUAL,
+		Title: "Bank transfer",
+		Settings: []Setting{
+			{Key: "instructions", Title: "Payment instructions", Required: true},
+		},
+		New: func(c Cfg, settings Settings) LitePay {
+			return c.Manual(settings["instructions"])
+		},
+	})
+}
+
+type manual struct {
+	Cfg
+	instructions string
+}
+
+// Manual is a payment system without an API. The buyer gets the payment
+// instructions by email and the admin marks the cart as paid when the
+// money arrives.
+func (c Cfg) Manual(instructions string) LitePay {
+	c.paymentSystem = MANUAL
+	return &manual{
+		Cfg:          c,
+		instructions: instructions,
+	}
+}
+
+func (c *manual) Pay(cart Cart) (*Payment, error) {
+	return &Payment{
+		PaymentSystem: c.paymentSystem,
+		CartID:        cart.ID,
+		AmountTotal:   cart.AmountTotal(),
+		Currency:      strings.ToUpper(cart.Currency),
+		Status:        AWAITING_PAYMENT,
+		URL:           fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.successURL, c.paymentSystem, cart.ID),
+		Instructions:  c.instructions,
+	}, nil
+}
+
+func (c *manual) Checkout(payment *Payment, session string) (*Payment, error) {
+	payment.Status = AWAITING_PAYMENT
+	return payment, nil
+}
+
+// Refund records the refund, the money is returned outside of litecart.
+func (c *manual) Refund(payment *Payment, amount int) (*Payment, error) {
+	refund := *payment
+	refund.AmountTotal = amount
+	refund.Status = refundStatus(payment, amount)
+
+	return &refund, nil
+}
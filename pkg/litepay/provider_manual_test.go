@@ -0,0 +1,34 @@
+package litepay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Manual(t *testing.T) {
+	pay := New("https://shop.com/callback", "https://shop.com/success", "https://shop.com/cancel").Manual("IBAN DE00 0000")
+
+	payment, err := pay.Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "eur",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1050}, Quantity: 2},
+			{PriceData: Price{UnitAmount: 99}, Quantity: 1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2199, payment.AmountTotal)
+	assert.Equal(t, "EUR", payment.Currency)
+	assert.Equal(t, AWAITING_PAYMENT, payment.Status)
+	assert.Equal(t, "IBAN DE00 0000", payment.Instructions)
+	assert.Equal(t, "https://shop.com/success/?payment_system=manual&cart_id=cart00000000001", payment.URL)
+
+	refund, err := pay.Refund(payment, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, PARTIALLY_REFUNDED, refund.Status)
+
+	provider, ok := Lookup(MANUAL)
+	assert.True(t, ok)
+	assert.True(t, provider.SupportCurrency("JPY"))
+}
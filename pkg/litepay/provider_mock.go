@@ -0,0 +1,120 @@
+package litepay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MockPagePath is the hosted payment page of the mock payment system, served by litecart.
+const MockPagePath = "/cart/payment/mock"
+
+// MockSignatureHeader carries the signature of a mock callback.
+const MockSignatureHeader = "Mock-Signature"
+
+func init() {
+	Register(Provider{
+		Name:  MOCK,
+		Title: "Mock",
+		Settings: []Setting{
+			{Key: "secret", Title: "Callback secret", Secret: true, Required: true},
+		},
+		New: func(c Cfg, settings Settings) LitePay {
+			return c.Mock()
+		},
+		Callback: mockCallback,
+		Dev:      true,
+	})
+}
+
+// CallbackMock is the notification sent by the mock payment page.
+type CallbackMock struct {
+	CartID      string `json:"cart_id"`
+	AmountTotal int    `json:"amount_total"`
+	Currency    string `json:"currency"`
+	Status      Status `json:"status"`
+}
+
+type mock struct {
+	Cfg
+}
+
+// Mock is a payment system for development and end-to-end tests. It does not
+// talk to any service, the buyer chooses the result on a page hosted by litecart.
+func (c Cfg) Mock() LitePay {
+	c.paymentSystem = MOCK
+	return &mock{
+		Cfg: c,
+	}
+}
+
+func (c *mock) Pay(cart Cart) (*Payment, error) {
+	return &Payment{
+		PaymentSystem: c.paymentSystem,
+		MerchantID:    "mock_" + cart.ID,
+		CartID:        cart.ID,
+		AmountTotal:   cart.AmountTotal(),
+		Currency:      strings.ToUpper(cart.Currency),
+		Status:        PROCESSED,
+		URL:           fmt.Sprintf("%s?cart_id=%s", MockPagePath, cart.ID),
+	}, nil
+}
+
+func (c *mock) Checkout(payment *Payment, session string) (*Payment, error) {
+	return payment, nil
+}
+
+func (c *mock) Refund(payment *Payment, amount int) (*Payment, error) {
+	refund := *payment
+	refund.AmountTotal = amount
+	refund.Status = refundStatus(payment, amount)
+
+	return &refund, nil
+}
+
+// SignMock returns the signature of a mock callback body.
+func SignMock(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func mockCallback(settings Settings, header http.Header, body []byte) (*Payment, error) {
+	if settings["secret"] == "" {
+		return nil, errors.New("mock callback secret is not set")
+	}
+
+	signature, err := hex.DecodeString(header.Get(MockSignatureHeader))
+	if err != nil {
+		return nil, errors.New("invalid mock signature")
+	}
+	expected, _ := hex.DecodeString(SignMock(body, settings["secret"]))
+	if !hmac.Equal(signature, expected) {
+		return nil, errors.New("mock signature mismatch")
+	}
+
+	callback := &CallbackMock{}
+	if err := json.Unmarshal(body, callback); err != nil {
+		return nil, err
+	}
+
+	// a mock payment is never revenue
+	status := callback.Status
+	if status == PAID {
+		status = TEST
+	}
+
+	return &Payment{
+		PaymentSystem: MOCK,
+		MerchantID:    "mock_" + callback.CartID,
+		CartID:        callback.CartID,
+		AmountTotal:   callback.AmountTotal,
+		Currency:      strings.ToUpper(callback.Currency),
+		Status:        status,
+	}, nil
+}
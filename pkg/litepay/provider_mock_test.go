@@ -0,0 +1,43 @@
+package litepay
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mockCallback(t *testing.T) {
+	settings := Settings{"secret": "mock_secret"}
+	body := []byte(`{"cart_id":"cart00000000001","amount_total":1500,"currency":"eur","status":"paid"}`)
+
+	cases := []struct {
+		signature string
+		err       bool
+	}{
+		{SignMock(body, "mock_secret"), false},
+		{SignMock(body, "other_secret"), true},
+		{"not-hex", true},
+		{"", true},
+	}
+
+	for _, tt := range cases {
+		header := http.Header{}
+		header.Set(MockSignatureHeader, tt.signature)
+
+		payment, err := mockCallback(settings, header, body)
+		if tt.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "cart00000000001", payment.CartID)
+		assert.Equal(t, 1500, payment.AmountTotal)
+		assert.Equal(t, "EUR", payment.Currency)
+		// a mock payment is stored as a test payment
+		assert.Equal(t, TEST, payment.Status)
+	}
+
+	_, err := mockCallback(Settings{}, http.Header{}, body)
+	assert.Error(t, err)
+}
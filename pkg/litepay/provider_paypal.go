@@ -9,16 +9,38 @@ import (
 	"strings"
 )
 
+var paypalCurrency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+
+func init() {
+	Register(Provider{
+		Name:  PAYPAL,
+		Title: "Paypal",
+		Settings: []Setting{
+			{Key: "client_id", Title: "Client ID", Required: true},
+			{Key: "secret_key", Title: "Secret key", Secret: true, Required: true},
+			{Key: "mode", Title: "Mode", Required: true},
+		},
+		Currency: paypalCurrency,
+		New: func(c Cfg, settings Settings) LitePay {
+			return c.Paypal(settings["client_id"], settings["secret_key"], Mode(settings["mode"]))
+		},
+		SessionParam: "token",
+	})
+}
+
 type paypal struct {
 	Cfg
 	clientID  string
 	secretKey string
 }
 
-func (c Cfg) Paypal(clientID, secretKey string) LitePay {
+func (c Cfg) Paypal(clientID, secretKey string, mode Mode) LitePay {
 	c.paymentSystem = PAYPAL
-	c.api = "https://api.sandbox.paypal.com" // https://api.paypal.com
-	c.currency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+	c.api = c.apiURL("https://api.paypal.com")
+	if mode != LIVE {
+		c.api = c.apiURL("https://api.sandbox.paypal.com")
+	}
+	c.currency = paypalCurrency
 	return &paypal{
 		Cfg:       c,
 		clientID:  clientID,
@@ -27,8 +49,6 @@ func (c Cfg) Paypal(clientID, secretKey string) LitePay {
 }
 
 func (c *paypal) Pay(cart Cart) (*Payment, error) {
-	var totalAmount float64
-
 	currency := strings.ToUpper(cart.Currency)
 	if !findInSlice(c.currency, strings.ToUpper(currency)) {
 		return nil, errors.New("this currency is not supported")
@@ -39,18 +59,28 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 		return nil, err
 	}
 
-	for _, s := range cart.Items {
-		totalAmount += float64(s.PriceData.UnitAmount) / 100 * float64(s.Quantity)
+	totalAmount := cart.AmountTotal()
+	items, itemTotal := paypalItems(cart.Items, currency)
+	breakdown := map[string]any{
+		"item_total": map[string]string{"currency_code": currency, "value": FormatAmount(itemTotal, currency)},
+	}
+	if taxAmount := cart.AmountTax(); taxAmount > 0 {
+		breakdown["tax_total"] = map[string]string{"currency_code": currency, "value": FormatAmount(taxAmount, currency)}
 	}
 
 	order := map[string]any{
 		"intent": "CAPTURE",
 		"purchase_units": []map[string]any{
 			{
+				"reference_id": cart.ID,
+				"custom_id":    cart.ID,
+				"invoice_id":   cart.ID,
 				"amount": map[string]any{
 					"currency_code": currency,
-					"value":         fmt.Sprintf("%.2f", totalAmount),
+					"value":         FormatAmount(totalAmount, currency),
+					"breakdown":     breakdown,
 				},
+				"items": items,
 			},
 		},
 		"payment_source": map[string]any{
@@ -81,12 +111,16 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return nil, paypalResponseError(resp)
+	}
+
 	var data struct {
 		ID    string `json:"id"`
 		Links []struct {
@@ -101,7 +135,8 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 	}
 
 	checkout := &Payment{
-		AmountTotal:   int(totalAmount * 100),
+		MerchantID:    data.ID,
+		AmountTotal:   totalAmount,
 		Currency:      currency,
 		Status:        StatusPayment(PAYPAL, data.Status),
 		PaymentSystem: c.paymentSystem,
@@ -117,6 +152,28 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 	return checkout, nil
 }
 
+// paypalItems returns the items of the order and their total. Taxes charged
+// on top of the prices are sent in the breakdown of the order, discounts are
+// part of the unit amounts.
+func paypalItems(cartItems []Item, currency string) ([]map[string]any, int) {
+	items := make([]map[string]any, 0, len(cartItems))
+	var total int
+	for _, item := range cartItems {
+		line := map[string]any{
+			"name":        truncate(item.PriceData.Product.Name, 127),
+			"quantity":    strconv.Itoa(item.Quantity),
+			"category":    "DIGITAL_GOODS",
+			"unit_amount": map[string]string{"currency_code": currency, "value": FormatAmount(item.PriceData.UnitAmount, currency)},
+		}
+		if item.PriceData.Product.Description != "" {
+			line["description"] = truncate(item.PriceData.Product.Description, 127)
+		}
+		items = append(items, line)
+		total += item.PriceData.UnitAmount * item.Quantity
+	}
+	return items, total
+}
+
 func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
 	accessToken, err := c.paypalAccessToken()
 	if err != nil {
@@ -134,7 +191,7 @@ func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -148,28 +205,18 @@ func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
 		return nil, errors.New("The server returned an error.")
 	}
 
-	var data struct {
-		ID            string `json:"id"`
-		Status        string `json:"status"`
-		PurchaseUnits []struct {
-			Payments struct {
-				Captures []struct {
-					Amount struct {
-						CurrencyCode string `json:"currency_code"`
-						Value        string `json:"value"`
-					} `json:"amount"`
-				} `json:"captures"`
-			} `json:"payments"`
-		} `json:"purchase_units"`
-	}
-
+	var data paypalOrder
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return nil, err
 	}
 
-	receiveAmount, _ := strconv.ParseFloat(data.PurchaseUnits[0].Payments.Captures[0].Amount.Value, 64)
-	payment.AmountTotal = int(receiveAmount * 100)
-	payment.Currency = data.PurchaseUnits[0].Payments.Captures[0].Amount.CurrencyCode
+	capture, err := data.capture()
+	if err != nil {
+		return nil, err
+	}
+	receiveAmount, _ := strconv.ParseFloat(capture.Amount.Value, 64)
+	payment.AmountTotal = ToMinor(receiveAmount, capture.Amount.CurrencyCode)
+	payment.Currency = capture.Amount.CurrencyCode
 	payment.MerchantID = data.ID
 	payment.Status = StatusPayment(PAYPAL, data.Status)
 
@@ -188,7 +235,7 @@ func (c *paypal) paypalAccessToken() (string, error) {
 	req.SetBasicAuth(c.clientID, c.secretKey)
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
@@ -204,3 +251,224 @@ func (c *paypal) paypalAccessToken() (string, error) {
 
 	return tokenResp.AccessToken, nil
 }
+
+func (c *paypal) Refund(payment *Payment, amount int) (*Payment, error) {
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	captureID, err := c.paypalCaptureID(accessToken, payment.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundJson, err := json.Marshal(map[string]any{
+		"amount": map[string]any{
+			"currency_code": strings.ToUpper(payment.Currency),
+			"value":         FormatAmount(amount, payment.Currency),
+		},
+		"invoice_id": payment.CartID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.api+"/v2/payments/captures/"+captureID+"/refund",
+		strings.NewReader(string(refundJson)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return nil, errors.New("The server returned an error.")
+	}
+
+	var data struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if data.Status != "COMPLETED" && data.Status != "PENDING" {
+		return nil, fmt.Errorf("refund was not accepted: %s", data.Status)
+	}
+
+	refund := *payment
+	refund.AmountTotal = amount
+	refund.Status = refundStatus(payment, amount)
+
+	return &refund, nil
+}
+
+func (c *paypal) Reconcile(payment *Payment) (*Payment, error) {
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		c.api+"/v2/checkout/orders/"+payment.MerchantID,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// orders that were never approved are removed by paypal
+	if resp.StatusCode == 404 {
+		reconciled := *payment
+		reconciled.Status = CANCELED
+		return &reconciled, nil
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("The server returned an error.")
+	}
+
+	var data paypalOrder
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	// the buyer approved the order but did not return to the shop
+	if data.Status == "APPROVED" {
+		return c.Checkout(payment, data.ID)
+	}
+
+	reconciled := *payment
+	reconciled.Status = StatusPayment(PAYPAL, data.Status)
+
+	// the amount is the one paypal captured, not the one of the cart
+	if reconciled.Status.Paid() {
+		capture, err := data.capture()
+		if err != nil {
+			return nil, err
+		}
+		receiveAmount, _ := strconv.ParseFloat(capture.Amount.Value, 64)
+		reconciled.AmountTotal = ToMinor(receiveAmount, capture.Amount.CurrencyCode)
+		reconciled.Currency = capture.Amount.CurrencyCode
+	}
+
+	return &reconciled, nil
+}
+
+// paypalCaptureID returns the ID of the first capture of the order.
+func (c *paypal) paypalCaptureID(accessToken, orderID string) (string, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		c.api+"/v2/checkout/orders/"+orderID,
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", errors.New("The server returned an error.")
+	}
+
+	var data paypalOrder
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+
+	capture, err := data.capture()
+	if err != nil {
+		return "", err
+	}
+
+	return capture.ID, nil
+}
+
+// paypalOrder is the part of a paypal order read by the shop.
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		Payments struct {
+			Captures []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
+type paypalCapture struct {
+	ID     string `json:"id"`
+	Amount struct {
+		CurrencyCode string `json:"currency_code"`
+		Value        string `json:"value"`
+	} `json:"amount"`
+}
+
+// capture returns the first capture of the order.
+func (o *paypalOrder) capture() (*paypalCapture, error) {
+	if len(o.PurchaseUnits) == 0 || len(o.PurchaseUnits[0].Payments.Captures) == 0 {
+		return nil, errors.New("order has no captured payments")
+	}
+	return &o.PurchaseUnits[0].Payments.Captures[0], nil
+}
+
+// paypalError is the error returned by the paypal API, the details name the
+// issue, for example ITEM_TOTAL_MISMATCH.
+type paypalError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Details []struct {
+		Field       string `json:"field"`
+		Issue       string `json:"issue"`
+		Description string `json:"description"`
+	} `json:"details"`
+}
+
+func (e *paypalError) Error() string {
+	var msg strings.Builder
+	msg.WriteString(e.Name + ": " + e.Message)
+	for _, detail := range e.Details {
+		msg.WriteString("; " + detail.Issue)
+		if detail.Field != "" {
+			msg.WriteString(" (" + detail.Field + ")")
+		}
+		if detail.Description != "" {
+			msg.WriteString(": " + detail.Description)
+		}
+	}
+	return msg.String()
+}
+
+// paypalResponseError returns the error of a failed response, the status is
+// used when the body has no paypal error.
+func paypalResponseError(resp *http.Response) error {
+	data := &paypalError{}
+	if err := json.NewDecoder(resp.Body).Decode(data); err != nil || data.Name == "" {
+		return fmt.Errorf("The server returned an error: %s", resp.Status)
+	}
+	return data
+}
@@ -0,0 +1,193 @@
+package litepay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PaypalItems(t *testing.T) {
+	type money struct {
+		CurrencyCode string `json:"currency_code"`
+		Value        string `json:"value"`
+	}
+	var order struct {
+		PurchaseUnits []struct {
+			ReferenceID string `json:"reference_id"`
+			CustomID    string `json:"custom_id"`
+			InvoiceID   string `json:"invoice_id"`
+			Amount      struct {
+				Value     string `json:"value"`
+				Breakdown struct {
+					ItemTotal *money `json:"item_total"`
+					TaxTotal  *money `json:"tax_total"`
+				} `json:"breakdown"`
+			} `json:"amount"`
+			Items []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Quantity    string `json:"quantity"`
+				UnitAmount  money  `json:"unit_amount"`
+			} `json:"items"`
+		} `json:"purchase_units"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/v2/checkout/orders":
+			body, _ := io.ReadAll(r.Body)
+			assert.NoError(t, json.Unmarshal(body, &order))
+			fmt.Fprint(w, `{"id":"ORDER1","status":"PAYER_ACTION_REQUIRED"}`)
+		}
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithBaseURL(PAYPAL, server.URL)
+	payment, err := cfg.Paypal("id", "secret", SANDBOX).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "usd",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1250, Product: Product{Name: "Ebook", Description: "A book"}}, Quantity: 2},
+			{PriceData: Price{UnitAmount: 999, Product: Product{Name: strings.Repeat("n", 200)}}, Quantity: 1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3499, payment.AmountTotal)
+
+	unit := order.PurchaseUnits[0]
+	assert.Equal(t, "cart00000000001", unit.ReferenceID)
+	assert.Equal(t, "cart00000000001", unit.CustomID)
+	assert.Equal(t, "cart00000000001", unit.InvoiceID)
+	assert.Equal(t, "34.99", unit.Amount.Value)
+	assert.Equal(t, &money{CurrencyCode: "USD", Value: "34.99"}, unit.Amount.Breakdown.ItemTotal)
+	assert.Nil(t, unit.Amount.Breakdown.TaxTotal)
+
+	assert.Len(t, unit.Items, 2)
+	assert.Equal(t, "Ebook", unit.Items[0].Name)
+	assert.Equal(t, "A book", unit.Items[0].Description)
+	assert.Equal(t, "2", unit.Items[0].Quantity)
+	assert.Equal(t, money{CurrencyCode: "USD", Value: "12.50"}, unit.Items[0].UnitAmount)
+	assert.Len(t, unit.Items[1].Name, 127)
+	assert.Empty(t, unit.Items[1].Description)
+}
+
+func Test_PaypalPayError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/v2/checkout/orders":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"name":"UNPROCESSABLE_ENTITY","message":"The requested action could not be performed.","details":[{"field":"/purchase_units/@reference_id=='cart00000000001'/amount/breakdown/item_total/value","issue":"ITEM_TOTAL_MISMATCH","description":"Should equal sum of (unit_amount * quantity) across all items."}]}`)
+		}
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(PAYPAL, server.URL).Paypal("id", "secret", SANDBOX)
+	payment, err := client.Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items:    []Item{{PriceData: Price{UnitAmount: 1000}, Quantity: 1}},
+	})
+	assert.Nil(t, payment)
+	assert.ErrorContains(t, err, "UNPROCESSABLE_ENTITY")
+	assert.ErrorContains(t, err, "ITEM_TOTAL_MISMATCH")
+}
+
+func Test_PaypalRefund(t *testing.T) {
+	var refund struct {
+		Amount struct {
+			CurrencyCode string `json:"currency_code"`
+			Value        string `json:"value"`
+		} `json:"amount"`
+		InvoiceID string `json:"invoice_id"`
+	}
+	order := `{"id":"ORDER1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAPTURE1"}]}}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/v2/checkout/orders/ORDER1":
+			fmt.Fprint(w, order)
+		case "/v2/payments/captures/CAPTURE1/refund":
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			body, _ := io.ReadAll(r.Body)
+			assert.NoError(t, json.Unmarshal(body, &refund))
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":"REFUND1","status":"COMPLETED"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(PAYPAL, server.URL).Paypal("id", "secret", SANDBOX)
+	payment := &Payment{CartID: "cart00000000001", MerchantID: "ORDER1", AmountTotal: 1000, Currency: "JPY"}
+
+	result, err := client.Refund(payment, 400)
+	assert.NoError(t, err)
+	assert.Equal(t, "JPY", refund.Amount.CurrencyCode)
+	assert.Equal(t, "400", refund.Amount.Value)
+	assert.Equal(t, "cart00000000001", refund.InvoiceID)
+	assert.Equal(t, 400, result.AmountTotal)
+	assert.Equal(t, PARTIALLY_REFUNDED, result.Status)
+
+	result, err = client.Refund(payment, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, REFUNDED, result.Status)
+
+	// an order that was not captured can not be refunded
+	order = `{"id":"ORDER1","status":"APPROVED","purchase_units":[{"payments":{}}]}`
+	_, err = client.Refund(payment, 1000)
+	assert.Error(t, err)
+}
+
+func Test_PaypalReconcile(t *testing.T) {
+	order := `{"id":"ORDER1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAPTURE1","amount":{"currency_code":"USD","value":"9.00"}}]}}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/v2/checkout/orders/ORDER1", "/v2/checkout/orders/ORDER1/capture":
+			fmt.Fprint(w, order)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(PAYPAL, server.URL).Paypal("id", "secret", SANDBOX)
+	payment := &Payment{CartID: "cart00000000001", MerchantID: "ORDER1", AmountTotal: 1000, Currency: "USD"}
+
+	// the captured amount is returned, not the amount of the cart
+	result, err := client.(Reconciler).Reconcile(payment)
+	assert.NoError(t, err)
+	assert.Equal(t, PAID, result.Status)
+	assert.Equal(t, 900, result.AmountTotal)
+	assert.Equal(t, "USD", result.Currency)
+	assert.False(t, result.Match(1000, "USD"))
+
+	// a completed order without captures is an error, not a paid cart
+	order = `{"id":"ORDER1","status":"COMPLETED","purchase_units":[{"payments":{}}]}`
+	_, err = client.(Reconciler).Reconcile(payment)
+	assert.Error(t, err)
+
+	_, err = client.Checkout(payment, "ORDER1")
+	assert.Error(t, err)
+
+	order = `{"id":"ORDER1","status":"COMPLETED","purchase_units":[]}`
+	_, err = client.Checkout(payment, "ORDER1")
+	assert.Error(t, err)
+}
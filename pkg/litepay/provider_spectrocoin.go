@@ -2,14 +2,62 @@ package litepay
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// spectrocoinPublicKeyURL is the location of the key Spectrocoin signs callbacks with.
+var spectrocoinPublicKeyURL = "https://spectrocoin.com/files/merchant.public.pem"
+
+// spectrocoinPublicKeyTTL is how long the downloaded public key is used
+// before it is downloaded again.
+const spectrocoinPublicKeyTTL = time.Hour
+
+// spectrocoinPublicKey is the last downloaded public key.
+var spectrocoinPublicKey struct {
+	sync.Mutex
+	key     string
+	fetched time.Time
+}
+
+// spectrocoinCallbackFields is the order in which callback fields are signed.
+var spectrocoinCallbackFields = []string{
+	"merchantId", "apiId", "userId", "merchantApiId", "orderId",
+	"payCurrency", "payAmount", "receiveCurrency", "receiveAmount", "receivedAmount",
+	"description", "orderRequestId", "status",
+}
+
+var spectrocoinCurrency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+
+// SpectrocoinPayCurrency lists the coins the buyer can be asked to pay with.
+var SpectrocoinPayCurrency = []string{"BTC", "ETH", "USDT", "USDC", "BNB", "LTC", "XRP", "DOGE", "TRX", "DAI"}
+
+func init() {
+	Register(Provider{
+		Name:  SPECTROCOIN,
+		Title: "Spectrocoin",
+		Settings: []Setting{
+			{Key: "merchant_id", Title: "Merchant ID", Required: true},
+			{Key: "project_id", Title: "Project ID", Required: true},
+			{Key: "private_key", Title: "Private key", Secret: true, Required: true},
+			{Key: "pay_currency", Title: "Pay currency"},
+		},
+		Currency: spectrocoinCurrency,
+		New: func(c Cfg, settings Settings) LitePay {
+			return c.Spectrocoin(settings["merchant_id"], settings["project_id"], settings["private_key"], settings["pay_currency"])
+		},
+		Callback: spectrocoinCallback,
+	})
+}
+
 type CallbackSpectrocoin struct {
 	MerchantID      int     `json:"merchantId" form:"merchantId"`
 	ApiID           int     `json:"apiId" form:"apiId"`
@@ -27,52 +75,101 @@ type CallbackSpectrocoin struct {
 	Sign            string  `json:"sign" form:"sign"`
 }
 
+// spectrocoinOrder is the order created by the Spectrocoin API.
+type spectrocoinOrder struct {
+	OrderRequestID  int         `json:"orderRequestId"`
+	OrderID         string      `json:"orderId"`
+	PayCurrency     string      `json:"payCurrency"`
+	PayAmount       json.Number `json:"payAmount"`
+	ReceiveCurrency string      `json:"receiveCurrency"`
+	ReceiveAmount   json.Number `json:"receiveAmount"`
+	RedirectURL     string      `json:"redirectUrl"`
+}
+
+// SpectrocoinError is an error returned by the Spectrocoin API.
+type SpectrocoinError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *SpectrocoinError) Error() string {
+	return fmt.Sprintf("spectrocoin error %d: %s", e.Code, e.Message)
+}
+
 type spectrocoin struct {
 	Cfg
-	merchantID string
-	projectID  string
-	privateKey string
+	merchantID  string
+	projectID   string
+	privateKey  string
+	payCurrency string
 }
 
-func (c Cfg) Spectrocoin(merchantID, projectID, privateKey string) LitePay {
+// Spectrocoin asks the buyer to pay in the payCurrency coin, BTC when it is empty.
+func (c Cfg) Spectrocoin(merchantID, projectID, privateKey, payCurrency string) LitePay {
 	c.paymentSystem = SPECTROCOIN
-	c.api = "https://spectrocoin.com"
-	c.currency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+	c.api = c.apiURL("https://spectrocoin.com")
+	c.currency = spectrocoinCurrency
+	if payCurrency == "" {
+		payCurrency = "BTC"
+	}
 	return &spectrocoin{
-		Cfg:        c,
-		merchantID: merchantID,
-		projectID:  projectID,
-		privateKey: privateKey,
+		Cfg:         c,
+		merchantID:  merchantID,
+		projectID:   projectID,
+		privateKey:  privateKey,
+		payCurrency: strings.ToUpper(payCurrency),
 	}
 }
 
+// spectrocoinCultures are the languages of the Spectrocoin payment window.
+var spectrocoinCultures = []string{"en", "lt", "ru", "de"}
+
+// spectrocoinCulture returns the language of the payment window for the
+// language of the buyer, English when Spectrocoin does not support it.
+func spectrocoinCulture(language string) string {
+	base := strings.ToLower(strings.SplitN(language, "-", 2)[0])
+	if findInSlice(spectrocoinCultures, base) {
+		return base
+	}
+	return "en"
+}
+
 func (c *spectrocoin) Pay(cart Cart) (*Payment, error) {
-	var totalAmount float64
 	receiveCurrency := strings.ToUpper(cart.Currency)
 
 	if !findInSlice(c.currency, receiveCurrency) {
 		return nil, errors.New("this currency is not supported")
 	}
+	if !findInSlice(SpectrocoinPayCurrency, c.payCurrency) {
+		return nil, errors.New("this pay currency is not supported")
+	}
 
-	for _, s := range cart.Items {
-		totalAmount += float64(s.PriceData.UnitAmount) / 100 * float64(s.Quantity)
+	names := []string{}
+	for _, item := range cart.Items {
+		names = append(names, item.PriceData.Product.Name)
 	}
 
-	_receiveAmount := fmt.Sprintf("%.2f", totalAmount)
-	_receiveAmount = strings.ReplaceAll(_receiveAmount, ".00", ".0")
+	_receiveAmount := FormatAmount(cart.AmountTotal(), receiveCurrency)
+	// spectrocoin expects "10.0" rather than "10.00"
+	if strings.Contains(_receiveAmount, ".") {
+		_receiveAmount = strings.TrimRight(_receiveAmount, "0")
+		if strings.HasSuffix(_receiveAmount, ".") {
+			_receiveAmount += "0"
+		}
+	}
 
 	body := "userId=" + c.merchantID +
 		"&merchantApiId=" + c.projectID +
 		"&orderId=" + cart.ID +
-		"&payCurrency=BTC" +
+		"&payCurrency=" + c.payCurrency +
 		"&payAmount=0.0" +
 		"&receiveCurrency=" + receiveCurrency +
 		"&receiveAmount=" + _receiveAmount +
-		"&description=" +
-		"&payerEmail=" +
+		"&description=" + spectrocoinEscape(truncate(strings.Join(names, ", "), 255)) +
+		"&payerEmail=" + spectrocoinEscape(cart.Email) +
 		"&payerName=" +
 		"&payerSurname=" +
-		"&culture=" +
+		"&culture=" + spectrocoinCulture(cart.Locale) +
 		"&callbackUrl=" + url.QueryEscape(fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.callbackURL, c.paymentSystem, cart.ID)) +
 		"&successUrl=" + url.QueryEscape(fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.successURL, c.paymentSystem, cart.ID)) +
 		"&failureUrl=" + url.QueryEscape(fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.cancelURL, c.paymentSystem, cart.ID))
@@ -83,29 +180,188 @@ func (c *spectrocoin) Pay(cart Cart) (*Payment, error) {
 	}
 	body += "&sign=" + url.QueryEscape(signature)
 
-	resp, err := http.Post(fmt.Sprintf("%s/api/merchant/1/createOrder", c.api), "application/x-www-form-urlencoded", bytes.NewBufferString(body))
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/merchant/1/createOrder", c.api), bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	data, err := parseBody(resp.Body)
+	order, err := spectrocoinResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	receiveAmount, _ := strconv.ParseFloat(data["receiveAmount"].(string), 64)
+	receiveAmount, _ := order.ReceiveAmount.Float64()
 	checkout := &Payment{
-		AmountTotal:   int(receiveAmount * 100),
-		Currency:      data["receiveCurrency"].(string),
+		MerchantID:    strconv.Itoa(order.OrderRequestID),
+		AmountTotal:   ToMinor(receiveAmount, order.ReceiveCurrency),
+		Currency:      strings.ToUpper(order.ReceiveCurrency),
 		Status:        PROCESSED,
-		URL:           data["redirectUrl"].(string),
+		URL:           order.RedirectURL,
 		PaymentSystem: c.paymentSystem,
 	}
+	if payAmount, err := order.PayAmount.Float64(); err == nil && payAmount > 0 {
+		checkout.Coin = &Coin{AmountTotal: payAmount, Currency: order.PayCurrency}
+	}
 
 	return checkout, nil
 }
 
+// spectrocoinResponse decodes the order created by the API. Spectrocoin
+// reports errors as a list of codes and messages, the first one is returned.
+func spectrocoinResponse(resp *http.Response) (*spectrocoinOrder, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body = bytes.TrimSpace(body); bytes.HasPrefix(body, []byte("[")) {
+		errs := []*SpectrocoinError{}
+		if err := json.Unmarshal(body, &errs); err != nil || len(errs) == 0 {
+			return nil, fmt.Errorf("spectrocoin returned status %d", resp.StatusCode)
+		}
+		return nil, errs[0]
+	}
+
+	order := &spectrocoinOrder{}
+	if err := json.Unmarshal(body, order); err != nil {
+		return nil, fmt.Errorf("spectrocoin returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != 200 || order.RedirectURL == "" {
+		return nil, fmt.Errorf("spectrocoin returned status %d without an order", resp.StatusCode)
+	}
+
+	return order, nil
+}
+
 func (c *spectrocoin) Checkout(payment *Payment, session string) (*Payment, error) {
 	return nil, nil
 }
+
+func (c *spectrocoin) Refund(payment *Payment, amount int) (*Payment, error) {
+	return nil, ErrRefundUnsupported
+}
+
+// SpectrocoinPublicKey returns the public key used to sign Spectrocoin
+// callbacks. The key is downloaded once per spectrocoinPublicKeyTTL, when the
+// download fails the previous key is used. Without a key the error wraps
+// ErrProviderUnavailable.
+func SpectrocoinPublicKey() (string, error) {
+	spectrocoinPublicKey.Lock()
+	defer spectrocoinPublicKey.Unlock()
+
+	if spectrocoinPublicKey.key != "" && time.Since(spectrocoinPublicKey.fetched) < spectrocoinPublicKeyTTL {
+		return spectrocoinPublicKey.key, nil
+	}
+
+	key, err := downloadSpectrocoinPublicKey()
+	if err != nil {
+		if spectrocoinPublicKey.key != "" {
+			return spectrocoinPublicKey.key, nil
+		}
+		return "", fmt.Errorf("%w: spectrocoin public key: %v", ErrProviderUnavailable, err)
+	}
+
+	spectrocoinPublicKey.key = key
+	spectrocoinPublicKey.fetched = time.Now()
+
+	return key, nil
+}
+
+func downloadSpectrocoinPublicKey() (string, error) {
+	resp, err := defaultClient.Get(spectrocoinPublicKeyURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	key, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
+
+// VerifyCallbackSpectrocoin parses the form-encoded callback body and checks
+// its signature with the Spectrocoin public key (RSA-SHA1).
+func VerifyCallbackSpectrocoin(body []byte, publicKey string) (*CallbackSpectrocoin, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// the message is built the same way as php http_build_query does it
+	message := []string{}
+	for _, field := range spectrocoinCallbackFields {
+		if !form.Has(field) {
+			continue
+		}
+		message = append(message, field+"="+spectrocoinEscape(form.Get(field)))
+	}
+
+	if err := verifyMessage(strings.Join(message, "&"), form.Get("sign"), publicKey); err != nil {
+		return nil, fmt.Errorf("invalid spectrocoin callback signature: %w", err)
+	}
+
+	callback := &CallbackSpectrocoin{
+		UserID:          form.Get("userId"),
+		MerchantApiID:   form.Get("merchantApiId"),
+		OrderID:         form.Get("orderId"),
+		PayCurrency:     form.Get("payCurrency"),
+		ReceiveCurrency: form.Get("receiveCurrency"),
+		Description:     form.Get("description"),
+		Sign:            form.Get("sign"),
+	}
+	callback.MerchantID, _ = strconv.Atoi(form.Get("merchantId"))
+	callback.ApiID, _ = strconv.Atoi(form.Get("apiId"))
+	callback.PayAmount, _ = strconv.ParseFloat(form.Get("payAmount"), 64)
+	callback.ReceiveAmount, _ = strconv.ParseFloat(form.Get("receiveAmount"), 64)
+	callback.ReceivedAmount, _ = strconv.Atoi(form.Get("receivedAmount"))
+	callback.OrderRequestID, _ = strconv.Atoi(form.Get("orderRequestId"))
+	callback.Status, _ = strconv.Atoi(form.Get("status"))
+
+	return callback, nil
+}
+
+// spectrocoinCallback converts a signed Spectrocoin callback into a payment.
+func spectrocoinCallback(settings Settings, header http.Header, body []byte) (*Payment, error) {
+	publicKey, err := SpectrocoinPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := VerifyCallbackSpectrocoin(body, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Payment{
+		PaymentSystem: SPECTROCOIN,
+		MerchantID:    strconv.Itoa(response.OrderRequestID),
+		CartID:        response.OrderID,
+		AmountTotal:   ToMinor(response.ReceiveAmount, response.ReceiveCurrency),
+		Currency:      strings.ToUpper(response.ReceiveCurrency),
+		Status:        StatusPayment(SPECTROCOIN, strconv.Itoa(response.Status)),
+		Coin: &Coin{
+			AmountTotal: response.PayAmount,
+			Currency:    response.PayCurrency,
+		},
+	}, nil
+}
+
+// spectrocoinEscape encodes a value the same way as php http_build_query does it,
+// Spectrocoin signs messages built by it.
+func spectrocoinEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "~", "%7E")
+}
@@ -0,0 +1,151 @@
+package litepay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_VerifyCallbackSpectrocoin(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+	pubKeyBytes, _ := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	pubKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes})
+
+	message := "merchantId=1&apiId=2&orderId=cart00000000001&payCurrency=BTC&payAmount=0.0001" +
+		"&receiveCurrency=EUR&receiveAmount=10.5&receivedAmount=0&description=Order+1&orderRequestId=3&status=3"
+	sign, err := signMessage(message, string(privKeyPem))
+	assert.NoError(t, err)
+
+	form, _ := url.ParseQuery(message)
+	form.Set("sign", sign)
+
+	callback, err := VerifyCallbackSpectrocoin([]byte(form.Encode()), string(pubKeyPem))
+	assert.NoError(t, err)
+	assert.Equal(t, "cart00000000001", callback.OrderID)
+	assert.Equal(t, 10.5, callback.ReceiveAmount)
+	assert.Equal(t, "EUR", callback.ReceiveCurrency)
+	assert.Equal(t, 3, callback.Status)
+
+	form.Set("status", "6")
+	_, err = VerifyCallbackSpectrocoin([]byte(form.Encode()), string(pubKeyPem))
+	assert.Error(t, err)
+}
+
+func Test_SpectrocoinPay(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+
+	var form url.Values
+	response := `{"orderRequestId":42,"orderId":"cart00000000001","payCurrency":"ETH","payAmount":0.0061,"receiveCurrency":"EUR","receiveAmount":"10.5","redirectUrl":"https://spectrocoin.com/pay"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	cart := Cart{
+		ID:       "cart00000000001",
+		Email:    "buyer@mail.com",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 500, Product: Product{Name: "Ebook"}}, Quantity: 1},
+			{PriceData: Price{UnitAmount: 550, Product: Product{Name: "Theme"}}, Quantity: 1},
+		},
+	}
+	provider := New("", "", "").WithBaseURL(SPECTROCOIN, server.URL).Spectrocoin("merchant", "project", string(privKeyPem), "eth")
+
+	payment, err := provider.Pay(cart)
+	assert.NoError(t, err)
+	assert.Equal(t, "ETH", form.Get("payCurrency"))
+	assert.Equal(t, "Ebook, Theme", form.Get("description"))
+	assert.Equal(t, "buyer@mail.com", form.Get("payerEmail"))
+	assert.Equal(t, "en", form.Get("culture"))
+	assert.Equal(t, "42", payment.MerchantID)
+	assert.Equal(t, 1050, payment.AmountTotal)
+	assert.Equal(t, &Coin{AmountTotal: 0.0061, Currency: "ETH"}, payment.Coin)
+
+	// the payment window is shown in the language of the buyer when spectrocoin supports it
+	cart.Locale = "de-AT"
+	_, err = provider.Pay(cart)
+	assert.NoError(t, err)
+	assert.Equal(t, "de", form.Get("culture"))
+	cart.Locale = "fr"
+	_, err = provider.Pay(cart)
+	assert.NoError(t, err)
+	assert.Equal(t, "en", form.Get("culture"))
+
+	response = `[{"code":99,"message":"Invalid merchant"}]`
+	_, err = provider.Pay(cart)
+	var apiErr *SpectrocoinError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 99, apiErr.Code)
+
+	response = `{"orderRequestId":43}`
+	_, err = provider.Pay(cart)
+	assert.Error(t, err)
+
+	_, err = New("", "", "").WithBaseURL(SPECTROCOIN, server.URL).Spectrocoin("merchant", "project", string(privKeyPem), "XXX").Pay(cart)
+	assert.Error(t, err)
+}
+
+func Test_SpectrocoinPublicKey(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+	pubKeyBytes, _ := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	pubKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes})
+
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(pubKeyPem)
+	}))
+	defer server.Close()
+
+	defaultURL := spectrocoinPublicKeyURL
+	spectrocoinPublicKeyURL = server.URL
+	defer func() {
+		spectrocoinPublicKeyURL = defaultURL
+		spectrocoinPublicKey.key = ""
+	}()
+
+	message := "merchantId=1&apiId=2&orderId=cart00000000001&payCurrency=BTC&payAmount=0.0001" +
+		"&receiveCurrency=EUR&receiveAmount=10.5&receivedAmount=0&description=Order+1&orderRequestId=3&status=3"
+	sign, _ := signMessage(message, string(privKeyPem))
+	form, _ := url.ParseQuery(message)
+	form.Set("sign", sign)
+
+	// the key is downloaded once for several callbacks
+	for i := 0; i < 2; i++ {
+		payment, err := spectrocoinCallback(Settings{}, http.Header{}, []byte(form.Encode()))
+		assert.NoError(t, err)
+		assert.Equal(t, PAID, payment.Status)
+	}
+	assert.Equal(t, 1, downloads)
+
+	// a forged callback is rejected
+	form.Set("receiveAmount", "0.1")
+	_, err := spectrocoinCallback(Settings{}, http.Header{}, []byte(form.Encode()))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrProviderUnavailable)
+
+	// without a key the callback can not be checked yet
+	spectrocoinPublicKey.key = ""
+	server.Close()
+	_, err = spectrocoinCallback(Settings{}, http.Header{}, []byte(form.Encode()))
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+}
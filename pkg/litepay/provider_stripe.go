@@ -1,53 +1,211 @@
 package litepay
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// stripeSignatureTolerance is the maximum age of a signed webhook event.
+const stripeSignatureTolerance = 5 * time.Minute
+
+// CallbackStripe is a webhook event sent by Stripe.
+type CallbackStripe struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID                string `json:"id"`
+			ClientReferenceID string `json:"client_reference_id"`
+			PaymentIntent     string `json:"payment_intent"`
+			Invoice           string `json:"invoice"`
+			PaymentStatus     string `json:"payment_status"`
+			Amount            int    `json:"amount"`
+			AmountTotal       int    `json:"amount_total"`
+			AmountRefunded    int    `json:"amount_refunded"`
+			AmountPaid        int    `json:"amount_paid"`
+			Currency          string `json:"currency"`
+			Status            string `json:"status"`
+			Subscription      string `json:"subscription"`
+			Customer          string `json:"customer"`
+			BillingReason     string `json:"billing_reason"`
+			CurrentPeriodEnd  int64  `json:"current_period_end"`
+			CancelAtPeriodEnd bool   `json:"cancel_at_period_end"`
+
+			TotalDetails struct {
+				AmountDiscount int `json:"amount_discount"`
+			} `json:"total_details"`
+			Metadata map[string]string `json:"metadata"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+var stripeCurrency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+
+func init() {
+	Register(Provider{
+		Name:  STRIPE,
+		Title: "Stripe",
+		Settings: []Setting{
+			{Key: "secret_key", Title: "Secret key", Secret: true, Required: true},
+			{Key: "webhook_secret", Title: "Webhook signing secret", Secret: true},
+			{Key: "mode", Title: "Mode", Required: true},
+			{Key: "locale", Title: "Checkout locale"},
+			{Key: "billing_address", Title: "Collect billing address"},
+			{Key: "promotion_codes", Title: "Allow promotion codes"},
+		},
+		Currency: stripeCurrency,
+		New: func(c Cfg, settings Settings) LitePay {
+			billingAddress, _ := strconv.ParseBool(settings["billing_address"])
+			promotionCodes, _ := strconv.ParseBool(settings["promotion_codes"])
+			return c.Stripe(settings["secret_key"], Mode(settings["mode"]), StripeCheckout{
+				Locale:         settings["locale"],
+				BillingAddress: billingAddress,
+				PromotionCodes: promotionCodes,
+			})
+		},
+		SessionParam: "session",
+		Callback:     stripeCallback,
+		Recurring:    true,
+	})
+}
+
+// StripeCheckout holds the optional settings of the Stripe Checkout page.
+type StripeCheckout struct {
+	Locale         string // "auto" or a locale supported by Stripe, used when the language of the buyer is not supported
+	BillingAddress bool   // the buyer must enter a billing address
+	PromotionCodes bool   // the buyer can enter a promotion code created in Stripe
+}
+
+// stripeLocales are the locales of the Stripe Checkout page.
+var stripeLocales = []string{"bg", "cs", "da", "de", "el", "en", "en-GB", "es", "es-419", "et", "fi", "fil", "fr", "fr-CA", "hr", "hu", "id", "it", "ja", "ko", "lt", "lv", "ms", "mt", "nb", "nl", "pl", "pt", "pt-BR", "ro", "ru", "sk", "sl", "sv", "th", "tr", "vi", "zh", "zh-HK", "zh-TW"}
+
 type stripe struct {
 	Cfg
 	apiToken   string
+	mode       Mode
+	checkout   StripeCheckout
 	successURL string
 	cancelURL  string
 }
 
-func (c Cfg) Stripe(apiToken string) LitePay {
+// Stripe uses one API for both modes, the environment is selected by the
+// secret key, so the mode is only checked against the key.
+func (c Cfg) Stripe(apiToken string, mode Mode, checkout StripeCheckout) LitePay {
 	c.paymentSystem = STRIPE
-	c.api = "https://api.stripe.com"
-	c.currency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
+	c.api = c.apiURL("https://api.stripe.com")
+	c.currency = stripeCurrency
 	return &stripe{
 		Cfg:        c,
 		apiToken:   apiToken,
+		mode:       mode,
+		checkout:   checkout,
 		successURL: c.successURL,
 		cancelURL:  c.cancelURL,
 	}
 }
 
+// locale returns the locale of the checkout page for the language of the
+// buyer, its base language ("pt" for "pt-PT") when only that is supported,
+// or else the locale of the settings, "auto" when it is not set.
+func (c *stripe) locale(language string) string {
+	for _, tag := range []string{language, strings.SplitN(language, "-", 2)[0]} {
+		for _, locale := range stripeLocales {
+			if tag != "" && strings.EqualFold(tag, locale) {
+				return locale
+			}
+		}
+	}
+	if c.checkout.Locale != "" {
+		return c.checkout.Locale
+	}
+	return "auto"
+}
+
 func (c *stripe) Pay(cart Cart) (*Payment, error) {
+	if testKey := strings.Contains(c.apiToken, "_test_"); testKey != (c.mode != LIVE) {
+		return nil, fmt.Errorf("stripe secret key does not match the %s mode", c.mode)
+	}
+
 	currency := strings.ToUpper(cart.Currency)
 	if !findInSlice(c.currency, strings.ToUpper(currency)) {
 		return nil, errors.New("this currency is not supported")
 	}
 
+	// a subscription bills all its recurring prices at once
+	intervals := cart.Intervals()
+	if len(intervals) > 1 {
+		return nil, errors.New("recurring items must have the same interval")
+	}
+
 	params := url.Values{}
+	oneOff, recurring := []Item{}, []Item{}
 	for i, s := range cart.Items {
 		iString := strconv.Itoa(i)
 		params.Add("line_items["+iString+"][price_data][unit_amount]", strconv.Itoa(s.PriceData.UnitAmount))
 		params.Add("line_items["+iString+"][price_data][currency]", currency)
 		params.Add("line_items["+iString+"][price_data][product_data][name]", s.PriceData.Product.Name)
+		if s.PriceData.Product.Description != "" {
+			params.Add("line_items["+iString+"][price_data][product_data][description]", s.PriceData.Product.Description)
+		}
 		for ii, img := range s.PriceData.Product.Images {
 			params.Add("line_items["+iString+"][price_data][product_data][images]["+strconv.Itoa(ii)+"]", img)
 		}
+		if s.PriceData.Recurring != nil {
+			params.Add("line_items["+iString+"][price_data][recurring][interval]", s.PriceData.Recurring.Interval)
+			recurring = append(recurring, s)
+		} else {
+			oneOff = append(oneOff, s)
+		}
 		params.Add("line_items["+iString+"][quantity]", strconv.Itoa(s.Quantity))
 	}
+	// taxes charged on top of the prices are shown as separate lines,
+	// the tax of recurring items is charged again with them
+	line := len(cart.Items)
+	for _, items := range [][]Item{oneOff, recurring} {
+		for _, tax := range taxLines(items) {
+			iString := strconv.Itoa(line)
+			params.Add("line_items["+iString+"][price_data][unit_amount]", strconv.Itoa(tax.Amount))
+			params.Add("line_items["+iString+"][price_data][currency]", currency)
+			params.Add("line_items["+iString+"][price_data][product_data][name]", tax.Title())
+			if items[0].PriceData.Recurring != nil {
+				params.Add("line_items["+iString+"][price_data][recurring][interval]", items[0].PriceData.Recurring.Interval)
+			}
+			params.Add("line_items["+iString+"][quantity]", "1")
+			line++
+		}
+	}
 	params.Add("success_url", fmt.Sprintf("%s/?payment_system=%s&cart_id=%s&session={CHECKOUT_SESSION_ID}", c.successURL, c.paymentSystem, cart.ID))
 	params.Add("cancel_url", fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.cancelURL, c.paymentSystem, cart.ID))
-	params.Add("mode", `payment`)
+	params.Add("client_reference_id", cart.ID)
+	params.Add("metadata[cart_id]", cart.ID)
+	if len(intervals) > 0 {
+		params.Add("mode", `subscription`)
+		// subscription events carry the cart through the metadata
+		params.Add("subscription_data[metadata][cart_id]", cart.ID)
+	} else {
+		params.Add("mode", `payment`)
+		// the payments listed in the dashboard are found by the cart
+		params.Add("payment_intent_data[metadata][cart_id]", cart.ID)
+	}
+	if cart.Email != "" {
+		params.Add("customer_email", cart.Email)
+	}
+	params.Add("locale", c.locale(cart.Locale))
+	if c.checkout.BillingAddress {
+		params.Add("billing_address_collection", "required")
+	}
+	if c.checkout.PromotionCodes {
+		params.Add("allow_promotion_codes", "true")
+	}
 	body := strings.NewReader(params.Encode())
 
 	req, err := http.NewRequest(
@@ -61,22 +219,36 @@ func (c *stripe) Pay(cart Cart) (*Payment, error) {
 	req.SetBasicAuth(c.apiToken, "")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		return nil, stripeResponseError(resp)
+	}
+
 	data, err := parseBody(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	id, _ := data["id"].(string)
+	sessionURL, _ := data["url"].(string)
+	if id == "" || sessionURL == "" {
+		return nil, errors.New("stripe returned a session without id or url")
+	}
+	amountTotal, _ := data["amount_total"].(float64)
+	sessionCurrency, _ := data["currency"].(string)
+	paymentStatus, _ := data["payment_status"].(string)
+
 	checkout := &Payment{
-		AmountTotal:   int(data["amount_total"].(float64)),
-		Currency:      strings.ToUpper(data["currency"].(string)),
-		Status:        StatusPayment(STRIPE, data["payment_status"].(string)),
-		URL:           data["url"].(string),
+		MerchantID:    id,
+		AmountTotal:   int(amountTotal),
+		Currency:      strings.ToUpper(sessionCurrency),
+		Status:        StatusPayment(STRIPE, paymentStatus),
+		URL:           sessionURL,
 		PaymentSystem: c.paymentSystem,
 	}
 
@@ -94,7 +266,258 @@ func (c *stripe) Checkout(payment *Payment, session string) (*Payment, error) {
 	}
 	req.SetBasicAuth(c.apiToken, "")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, stripeResponseError(resp)
+	}
+
+	data, err := parseBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a subscription session has no payment intent, the cart keeps its first invoice
+	amountTotal, _ := data["amount_total"].(float64)
+	currency, _ := data["currency"].(string)
+	paymentStatus, _ := data["payment_status"].(string)
+	payment.MerchantID, _ = data["payment_intent"].(string)
+	if payment.MerchantID == "" {
+		payment.MerchantID, _ = data["invoice"].(string)
+	}
+	payment.AmountTotal = int(amountTotal)
+	payment.Currency = strings.ToUpper(currency)
+	payment.AmountDiscount = stripeDiscount(data)
+	payment.Status = StatusPayment(STRIPE, paymentStatus)
+	if subscription, ok := data["subscription"].(string); ok && subscription != "" {
+		customer, _ := data["customer"].(string)
+		payment.Subscription = &Subscription{ID: subscription, Customer: customer, Status: SUBSCRIPTION_ACTIVE}
+	}
+
+	return payment, nil
+}
+
+// invoicePaymentIntent returns the payment intent that paid the invoice.
+func (c *stripe) invoicePaymentIntent(invoice string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.api+"/v1/invoices/"+invoice, nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", stripeResponseError(resp)
+	}
+
+	data, err := parseBody(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	paymentIntent, _ := data["payment_intent"].(string)
+	if paymentIntent == "" {
+		return "", fmt.Errorf("stripe invoice %s has no payment", invoice)
+	}
+
+	return paymentIntent, nil
+}
+
+// stripeResponseError returns the message of the error returned by the
+// stripe API, the status is used when the body has none.
+func stripeResponseError(resp *http.Response) error {
+	var data struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil || data.Error.Message == "" {
+		return fmt.Errorf("The server returned an error: %s", resp.Status)
+	}
+	if data.Error.Code != "" {
+		return fmt.Errorf("stripe: %s (%s)", data.Error.Message, data.Error.Code)
+	}
+	return fmt.Errorf("stripe: %s", data.Error.Message)
+}
+
+// stripeDiscount returns the discount of a promotion code entered on the
+// Checkout page of the session.
+func stripeDiscount(session map[string]any) int {
+	details, _ := session["total_details"].(map[string]any)
+	discount, _ := details["amount_discount"].(float64)
+	return int(discount)
+}
+
+func (c *stripe) Refund(payment *Payment, amount int) (*Payment, error) {
+	// a subscription cart keeps its first invoice, which was paid by a payment intent
+	paymentIntent := payment.MerchantID
+	if strings.HasPrefix(paymentIntent, "in_") {
+		var err error
+		paymentIntent, err = c.invoicePaymentIntent(paymentIntent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	params.Add("payment_intent", paymentIntent)
+	params.Add("amount", strconv.Itoa(amount))
+	params.Add("metadata[cart_id]", payment.CartID)
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.api+"/v1/refunds",
+		strings.NewReader(params.Encode()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, stripeResponseError(resp)
+	}
+
+	data, err := parseBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	status, _ := data["status"].(string)
+	if status != "succeeded" && status != "pending" {
+		return nil, fmt.Errorf("refund was not accepted: %s", status)
+	}
+
+	refund := *payment
+	refund.AmountTotal = amount
+	refund.Status = refundStatus(payment, amount)
+
+	return &refund, nil
+}
+
+func (c *stripe) Reconcile(payment *Payment) (*Payment, error) {
+	// the cart keeps the session id until the payment intent replaces it
+	url := c.api + "/v1/checkout/sessions/" + payment.MerchantID
+	if !strings.HasPrefix(payment.MerchantID, "cs_") {
+		url = c.api + "/v1/checkout/sessions?limit=1&payment_intent=" + payment.MerchantID
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, stripeResponseError(resp)
+	}
+
+	data, err := parseBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if list, ok := data["data"].([]any); ok {
+		if len(list) == 0 {
+			return nil, errors.New("Checkout session not found.")
+		}
+		data, _ = list[0].(map[string]any)
+	}
+
+	amountTotal, _ := data["amount_total"].(float64)
+	currency, _ := data["currency"].(string)
+	paymentStatus, _ := data["payment_status"].(string)
+	reconciled := *payment
+	reconciled.AmountTotal = int(amountTotal)
+	reconciled.AmountDiscount = stripeDiscount(data)
+	reconciled.Currency = strings.ToUpper(currency)
+	reconciled.Status = StatusPayment(STRIPE, paymentStatus)
+	if data["status"] == "expired" {
+		reconciled.Status = CANCELED
+	}
+	if paymentIntent, ok := data["payment_intent"].(string); ok && reconciled.Status == PAID {
+		reconciled.MerchantID = paymentIntent
+	}
+	if invoice, ok := data["invoice"].(string); ok && invoice != "" && reconciled.Status == PAID {
+		reconciled.MerchantID = invoice
+	}
+	if subscription, ok := data["subscription"].(string); ok && subscription != "" && reconciled.Status == PAID {
+		customer, _ := data["customer"].(string)
+		reconciled.Subscription = &Subscription{ID: subscription, Customer: customer, Status: SUBSCRIPTION_ACTIVE}
+	}
+
+	return &reconciled, nil
+}
+
+// Expire closes the checkout session, so that it can not be paid anymore. A
+// session that expired already is left as it is, a session that was completed
+// meanwhile is an error.
+func (c *stripe) Expire(payment *Payment) error {
+	// a failed asynchronous payment replaced the session by its payment intent,
+	// the session was completed and can not be paid again
+	if !strings.HasPrefix(payment.MerchantID, "cs_") {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.api+"/v1/checkout/sessions/"+payment.MerchantID+"/expire", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == 200 {
+		return nil
+	}
+
+	// stripe refuses to expire a session that is not open
+	session, err := c.Reconcile(payment)
+	if err != nil {
+		return err
+	}
+	if session.Status != CANCELED {
+		return fmt.Errorf("stripe session %s can not be expired, its payment is %s", payment.MerchantID, session.Status)
+	}
+
+	return nil
+}
+
+func (c *stripe) CancelSubscription(id string) (*Subscription, error) {
+	req, err := http.NewRequest(http.MethodDelete, c.api+"/v1/subscriptions/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -109,10 +532,139 @@ func (c *stripe) Checkout(payment *Payment, session string) (*Payment, error) {
 		return nil, err
 	}
 
-	payment.MerchantID = data["payment_intent"].(string)
-	payment.AmountTotal = int(data["amount_total"].(float64))
-	payment.Currency = strings.ToUpper(data["currency"].(string))
-	payment.Status = StatusPayment(STRIPE, data["payment_status"].(string))
+	status, _ := data["status"].(string)
+	periodEnd, _ := data["current_period_end"].(float64)
+	return &Subscription{
+		ID:               id,
+		Status:           SubscriptionStatus(status),
+		CurrentPeriodEnd: int64(periodEnd),
+	}, nil
+}
+
+// StripeEvent verifies the Stripe-Signature header of a webhook request
+// against the endpoint secret and decodes the event.
+func StripeEvent(payload []byte, signature, secret string) (*CallbackStripe, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return nil, errors.New("invalid stripe signature header")
+	}
+
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid stripe signature timestamp")
+	}
+	if time.Since(time.Unix(unixTime, 0)).Abs() > stripeSignatureTolerance {
+		return nil, errors.New("stripe signature timestamp is outside the tolerance zone")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	verified := false
+	for _, sig := range signatures {
+		decoded, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("stripe signature mismatch")
+	}
+
+	event := &CallbackStripe{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// stripeCallback converts a Stripe webhook event into a payment.
+func stripeCallback(settings Settings, header http.Header, body []byte) (*Payment, error) {
+	if settings["webhook_secret"] == "" {
+		return nil, errors.New("stripe webhook secret is not configured")
+	}
+
+	event, err := StripeEvent(body, header.Get("Stripe-Signature"), settings["webhook_secret"])
+	if err != nil {
+		return nil, err
+	}
+	object := event.Data.Object
+
+	payment := &Payment{
+		PaymentSystem: STRIPE,
+		MerchantID:    object.PaymentIntent,
+		Currency:      strings.ToUpper(object.Currency),
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		payment.CartID = object.ClientReferenceID
+		payment.AmountTotal = object.AmountTotal
+		payment.AmountDiscount = object.TotalDetails.AmountDiscount
+		payment.Status = StatusPayment(STRIPE, object.PaymentStatus)
+		if payment.Status == UNPAID {
+			payment.Status = PROCESSED // waiting for an asynchronous payment method
+		}
+		if object.Subscription != "" {
+			payment.Subscription = &Subscription{ID: object.Subscription, Customer: object.Customer, Status: SUBSCRIPTION_ACTIVE}
+		}
+		// a subscription session has no payment intent, the cart keeps its first invoice
+		if payment.MerchantID == "" {
+			payment.MerchantID = object.Invoice
+		}
+	case "checkout.session.async_payment_failed":
+		payment.CartID = object.ClientReferenceID
+		payment.AmountTotal = object.AmountTotal
+		payment.Status = FAILED
+	case "charge.refunded":
+		// the charge of a subscription is found by its invoice
+		if object.Invoice != "" {
+			payment.MerchantID = object.Invoice
+		}
+		payment.AmountTotal = object.Amount
+		payment.AmountRefunded = object.AmountRefunded
+		payment.Status = PARTIALLY_REFUNDED
+		if object.AmountRefunded >= object.Amount {
+			payment.Status = REFUNDED
+		}
+	case "invoice.paid":
+		// the first invoice of a subscription is paid by the checkout session
+		if object.BillingReason != "subscription_cycle" {
+			return nil, nil
+		}
+		payment.AmountTotal = object.AmountPaid
+		payment.Status = PAID
+		payment.Subscription = &Subscription{ID: object.Subscription, Customer: object.Customer, Invoice: object.ID}
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		payment.Subscription = &Subscription{
+			ID:                object.ID,
+			CartID:            object.Metadata["cart_id"],
+			Customer:          object.Customer,
+			Status:            SubscriptionStatus(object.Status),
+			CurrentPeriodEnd:  object.CurrentPeriodEnd,
+			CancelAtPeriodEnd: object.CancelAtPeriodEnd,
+		}
+	default:
+		return nil, nil
+	}
 
 	return payment, nil
 }
@@ -0,0 +1,260 @@
+package litepay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StripeEvent(t *testing.T) {
+	secret := "whsec_test"
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","client_reference_id":"cart00000000001","payment_intent":"pi_1","payment_status":"paid"}}}`)
+
+	sign := func(timestamp int64, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(fmt.Sprintf("%d.%s", timestamp, payload)))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	now := time.Now().Unix()
+	cases := []struct {
+		header string
+		err    bool
+	}{
+		{fmt.Sprintf("t=%d,v1=%s", now, sign(now, secret)), false},
+		{fmt.Sprintf("t=%d,v1=0000,v1=%s", now, sign(now, secret)), false},
+		{fmt.Sprintf("t=%d,v1=%s", now, sign(now, "whsec_other")), true},
+		{fmt.Sprintf("t=%d,v1=%s", now-3600, sign(now-3600, secret)), true},
+		{fmt.Sprintf("v1=%s", sign(now, secret)), true},
+		{"", true},
+	}
+
+	for _, tt := range cases {
+		event, err := StripeEvent(payload, tt.header, secret)
+		if tt.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "checkout.session.completed", event.Type)
+		assert.Equal(t, "cart00000000001", event.Data.Object.ClientReferenceID)
+		assert.Equal(t, "pi_1", event.Data.Object.PaymentIntent)
+	}
+}
+
+func Test_StripeCheckout(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"id":"cs_test_1","payment_intent":"pi_1","amount_total":1500,"currency":"eur","payment_status":"paid","total_details":{"amount_discount":500}}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		fmt.Fprint(w, `{"id":"cs_test_1","amount_total":2000,"currency":"eur","payment_status":"unpaid","url":"https://checkout.stripe.com/pay"}`)
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithBaseURL(STRIPE, server.URL)
+	client := cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{Locale: "de", BillingAddress: true, PromotionCodes: true})
+	_, err := client.Pay(Cart{
+		ID:       "cart00000000001",
+		Email:    "buyer@example.com",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 2000, Product: Product{Name: "Book", Description: "A book"}}, Quantity: 1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "buyer@example.com", form.Get("customer_email"))
+	assert.Equal(t, "de", form.Get("locale"))
+	assert.Equal(t, "required", form.Get("billing_address_collection"))
+	assert.Equal(t, "true", form.Get("allow_promotion_codes"))
+	assert.Equal(t, "cart00000000001", form.Get("client_reference_id"))
+	assert.Equal(t, "cart00000000001", form.Get("metadata[cart_id]"))
+	assert.Equal(t, "cart00000000001", form.Get("payment_intent_data[metadata][cart_id]"))
+	assert.Equal(t, "A book", form.Get("line_items[0][price_data][product_data][description]"))
+
+	// a promotion code lowers the amount paid, the cart still matches
+	payment, err := client.Checkout(&Payment{CartID: "cart00000000001"}, "cs_test_1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1500, payment.AmountTotal)
+	assert.Equal(t, 500, payment.AmountDiscount)
+	assert.True(t, payment.Match(2000, "EUR"))
+	assert.False(t, payment.Match(1500, "EUR"))
+
+	// without the optional settings nothing is sent
+	_, err = cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{}).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items:    []Item{{PriceData: Price{UnitAmount: 2000, Product: Product{Name: "Book"}}, Quantity: 1}},
+	})
+	assert.NoError(t, err)
+	for _, key := range []string{"customer_email", "billing_address_collection", "allow_promotion_codes", "line_items[0][price_data][product_data][description]"} {
+		assert.False(t, form.Has(key), key)
+	}
+	assert.Equal(t, "auto", form.Get("locale"))
+
+	// the page is shown in the language of the buyer when stripe supports it
+	cases := []struct {
+		language string
+		locale   string
+	}{
+		{"fr-CA", "fr-CA"},
+		{"pt-pt", "pt"},
+		{"en-US", "en"},
+		{"xx", "de"},
+	}
+	for _, tt := range cases {
+		_, err = client.Pay(Cart{
+			ID:       "cart00000000001",
+			Currency: "EUR",
+			Items:    []Item{{PriceData: Price{UnitAmount: 2000, Product: Product{Name: "Book"}}, Quantity: 1}},
+			Locale:   tt.language,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.locale, form.Get("locale"), tt.language)
+	}
+}
+
+func Test_StripePayError(t *testing.T) {
+	response := `{"error":{"code":"amount_too_small","message":"The Checkout Session's total amount due must add up to at least $0.50 usd","type":"invalid_request_error"}}`
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(STRIPE, server.URL).Stripe("sk_test_key", SANDBOX, StripeCheckout{})
+	cart := Cart{
+		ID:       "cart00000000001",
+		Currency: "USD",
+		Items:    []Item{{PriceData: Price{UnitAmount: 10}, Quantity: 1}},
+	}
+
+	payment, err := client.Pay(cart)
+	assert.Nil(t, payment)
+	assert.ErrorContains(t, err, "must add up to at least")
+	assert.ErrorContains(t, err, "amount_too_small")
+
+	// a session without the expected fields is an error, not a panic
+	status = http.StatusOK
+	response = `{"object":"checkout.session"}`
+	payment, err = client.Pay(cart)
+	assert.Nil(t, payment)
+	assert.Error(t, err)
+}
+
+func Test_StripeRefund(t *testing.T) {
+	var form url.Values
+	status := "succeeded"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/refunds", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"re_1","status":"%s"}`, status)
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(STRIPE, server.URL).Stripe("sk_test_key", SANDBOX, StripeCheckout{})
+	payment := &Payment{CartID: "cart00000000001", MerchantID: "pi_1", AmountTotal: 2000, Currency: "EUR"}
+
+	refund, err := client.Refund(payment, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, "pi_1", form.Get("payment_intent"))
+	assert.Equal(t, "500", form.Get("amount"))
+	assert.Equal(t, "cart00000000001", form.Get("metadata[cart_id]"))
+	assert.Equal(t, 500, refund.AmountTotal)
+	assert.Equal(t, PARTIALLY_REFUNDED, refund.Status)
+
+	refund, err = client.Refund(payment, 2000)
+	assert.NoError(t, err)
+	assert.Equal(t, REFUNDED, refund.Status)
+
+	status = "failed"
+	_, err = client.Refund(payment, 2000)
+	assert.Error(t, err)
+}
+
+func Test_StripeRefundInvoice(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/invoices/in_1":
+			fmt.Fprint(w, `{"id":"in_1","payment_intent":"pi_1"}`)
+		case "/v1/refunds":
+			body, _ := io.ReadAll(r.Body)
+			form, _ = url.ParseQuery(string(body))
+			fmt.Fprint(w, `{"id":"re_1","status":"succeeded"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"No such invoice"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(STRIPE, server.URL).Stripe("sk_test_key", SANDBOX, StripeCheckout{})
+
+	// the cart of a subscription is refunded through the payment of its first invoice
+	refund, err := client.Refund(&Payment{CartID: "cart00000000001", MerchantID: "in_1", AmountTotal: 2000, Currency: "EUR"}, 2000)
+	assert.NoError(t, err)
+	assert.Equal(t, "pi_1", form.Get("payment_intent"))
+	assert.Equal(t, REFUNDED, refund.Status)
+
+	_, err = client.Refund(&Payment{MerchantID: "in_2", AmountTotal: 2000, Currency: "EUR"}, 2000)
+	assert.ErrorContains(t, err, "No such invoice")
+}
+
+func Test_StripeExpire(t *testing.T) {
+	var expired int
+	session := `{"id":"cs_1","status":"open","payment_status":"unpaid","amount_total":2000,"currency":"eur"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/checkout/sessions/cs_1/expire":
+			expired++
+			if expired > 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"message":"session is not open"}}`)
+				return
+			}
+			fmt.Fprint(w, session)
+		case "/v1/checkout/sessions/cs_1":
+			fmt.Fprint(w, session)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New("", "", "").WithBaseURL(STRIPE, server.URL).Stripe("sk_test_key", SANDBOX, StripeCheckout{}).(Expirer)
+
+	assert.NoError(t, client.Expire(&Payment{MerchantID: "cs_1"}))
+	assert.Equal(t, 1, expired)
+
+	// a session that expired already can not be paid either
+	session = `{"id":"cs_1","status":"expired","payment_status":"unpaid","amount_total":2000,"currency":"eur"}`
+	assert.NoError(t, client.Expire(&Payment{MerchantID: "cs_1"}))
+
+	// a session paid in the meantime is not replaced
+	session = `{"id":"cs_1","status":"complete","payment_status":"paid","amount_total":2000,"currency":"eur"}`
+	assert.Error(t, client.Expire(&Payment{MerchantID: "cs_1"}))
+
+	// the payment intent of a failed payment has no open session
+	assert.NoError(t, client.Expire(&Payment{MerchantID: "pi_1"}))
+	assert.Equal(t, 3, expired)
+}
@@ -0,0 +1,113 @@
+package litepay
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrProviderNotFound is returned when no provider is registered under the requested name.
+var ErrProviderNotFound = errors.New("payment system is not registered")
+
+// Setting describes a provider setting. It is stored as "<provider>_<key>".
+// A secret setting is masked when the settings are read by the admin, a
+// required setting can not be saved empty.
+type Setting struct {
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	Secret   bool   `json:"secret,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Settings holds provider setting values keyed by Setting.Key.
+type Settings map[string]string
+
+// Provider describes a payment system that can be plugged into litecart.
+type Provider struct {
+	Name     PaymentSystem `json:"name"`
+	Title    string        `json:"title"`
+	Settings []Setting     `json:"settings"`
+	Currency []string      `json:"currency"`
+
+	// New creates a client of the payment system from its settings.
+	New func(c Cfg, settings Settings) LitePay `json:"-"`
+
+	// SessionParam is the query parameter of the success redirect that
+	// carries the provider session, used to call Checkout. Optional.
+	SessionParam string `json:"-"`
+
+	// Callback parses and verifies a notification sent by the payment
+	// system to the callback URL. It returns nil when the notification
+	// does not concern a payment. Optional.
+	Callback func(settings Settings, header http.Header, body []byte) (*Payment, error) `json:"-"`
+
+	// Recurring marks payment systems that bill recurring prices as
+	// subscriptions, their clients implement Subscriber.
+	Recurring bool `json:"recurring,omitempty"`
+
+	// Dev marks payment systems for testing, they are active in development
+	// mode without being enabled in the settings.
+	Dev bool `json:"dev,omitempty"`
+}
+
+// SupportCurrency reports whether the provider accepts the currency.
+// A provider without a currency list accepts any currency.
+func (p Provider) SupportCurrency(currency string) bool {
+	return len(p.Currency) == 0 || findInSlice(p.Currency, strings.ToUpper(currency))
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[PaymentSystem]Provider{}
+)
+
+// Register makes a payment system available by its name.
+// It panics if the provider is registered twice or has no constructor.
+func Register(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if provider.New == nil {
+		panic("litepay: Register provider without constructor " + string(provider.Name))
+	}
+	if _, dup := providers[provider.Name]; dup {
+		panic("litepay: Register called twice for provider " + string(provider.Name))
+	}
+	providers[provider.Name] = provider
+}
+
+// Lookup returns the provider registered under the name.
+func Lookup(name PaymentSystem) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// Providers returns the registered providers sorted by name.
+func Providers() []Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	list := make([]Provider, 0, len(providers))
+	for _, provider := range providers {
+		list = append(list, provider)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// Provider creates a client of the registered payment system.
+func (c Cfg) Provider(name PaymentSystem, settings Settings) (LitePay, error) {
+	provider, ok := Lookup(name)
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return provider.New(c, settings), nil
+}
@@ -0,0 +1,27 @@
+package litepay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Providers(t *testing.T) {
+	names := []PaymentSystem{}
+	for _, provider := range Providers() {
+		names = append(names, provider.Name)
+	}
+	assert.Subset(t, names, []PaymentSystem{PAYPAL, SPECTROCOIN, STRIPE})
+
+	provider, ok := Lookup(STRIPE)
+	assert.True(t, ok)
+	assert.True(t, provider.SupportCurrency("usd"))
+	assert.False(t, provider.SupportCurrency("XXX"))
+
+	_, err := New("", "", "").Provider("unknown", Settings{})
+	assert.Equal(t, ErrProviderNotFound, err)
+
+	assert.Panics(t, func() {
+		Register(provider)
+	})
+}
@@ -0,0 +1,46 @@
+package litepay
+
+// SubscriptionStatus is the status of a subscription in the payment system.
+type SubscriptionStatus string
+
+const (
+	SUBSCRIPTION_ACTIVE             SubscriptionStatus = "active"
+	SUBSCRIPTION_TRIALING           SubscriptionStatus = "trialing"
+	SUBSCRIPTION_PAST_DUE           SubscriptionStatus = "past_due"
+	SUBSCRIPTION_UNPAID             SubscriptionStatus = "unpaid"
+	SUBSCRIPTION_PAUSED             SubscriptionStatus = "paused"
+	SUBSCRIPTION_INCOMPLETE         SubscriptionStatus = "incomplete"
+	SUBSCRIPTION_INCOMPLETE_EXPIRED SubscriptionStatus = "incomplete_expired"
+	SUBSCRIPTION_CANCELED           SubscriptionStatus = "canceled"
+)
+
+// Active reports whether the buyer keeps access to the subscription.
+// A past due subscription is still retried by the payment system.
+func (s SubscriptionStatus) Active() bool {
+	return s == SUBSCRIPTION_ACTIVE || s == SUBSCRIPTION_TRIALING || s == SUBSCRIPTION_PAST_DUE
+}
+
+// Recurring is the billing period of a price that is charged again every
+// interval: day, week, month or year.
+type Recurring struct {
+	Interval string `json:"interval"`
+}
+
+// Subscription is a recurring payment in the payment system.
+// Invoice is set on the notification of a renewal, CartID on the
+// notifications that carry the cart the subscription was bought with.
+type Subscription struct {
+	ID                string             `json:"id"`
+	CartID            string             `json:"cart_id,omitempty"`
+	Customer          string             `json:"customer,omitempty"`
+	Status            SubscriptionStatus `json:"status,omitempty"`
+	CurrentPeriodEnd  int64              `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd bool               `json:"cancel_at_period_end,omitempty"`
+	Invoice           string             `json:"invoice,omitempty"`
+}
+
+// Subscriber is implemented by providers that bill recurring prices.
+type Subscriber interface {
+	// CancelSubscription stops the subscription at once, the buyer is not charged again.
+	CancelSubscription(id string) (*Subscription, error)
+}
@@ -0,0 +1,118 @@
+package litepay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StripeSubscription(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"cs_test_1","amount_total":1800,"currency":"eur","payment_status":"unpaid","url":"https://checkout.stripe.com/pay"}`)
+	}))
+	defer server.Close()
+
+	monthly := &Recurring{Interval: "month"}
+	cfg := New("", "", "").WithBaseURL(STRIPE, server.URL)
+	_, err := cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{}).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1000, Product: Product{Name: "Membership"}, Recurring: monthly}, Quantity: 1, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 200}},
+			{PriceData: Price{UnitAmount: 500, Product: Product{Name: "Book"}}, Quantity: 1, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 100}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "subscription", form.Get("mode"))
+	assert.Equal(t, "cart00000000001", form.Get("subscription_data[metadata][cart_id]"))
+	assert.Equal(t, "month", form.Get("line_items[0][price_data][recurring][interval]"))
+	assert.Empty(t, form.Get("line_items[1][price_data][recurring][interval]"))
+	// the tax of the book is charged once, the tax of the membership every month
+	assert.Equal(t, "100", form.Get("line_items[2][price_data][unit_amount]"))
+	assert.Empty(t, form.Get("line_items[2][price_data][recurring][interval]"))
+	assert.Equal(t, "200", form.Get("line_items[3][price_data][unit_amount]"))
+	assert.Equal(t, "month", form.Get("line_items[3][price_data][recurring][interval]"))
+
+	_, err = cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{}).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1000, Recurring: monthly}, Quantity: 1},
+			{PriceData: Price{UnitAmount: 9000, Recurring: &Recurring{Interval: "year"}}, Quantity: 1},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func Test_StripeSubscriptionCallback(t *testing.T) {
+	secret := "whsec_test"
+	sign := func(payload string) http.Header {
+		now := time.Now().Unix()
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(fmt.Sprintf("%d.%s", now, payload)))
+		header := http.Header{}
+		header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now, hex.EncodeToString(mac.Sum(nil))))
+		return header
+	}
+	settings := Settings{"webhook_secret": secret}
+
+	cases := []struct {
+		payload      string
+		status       Status
+		subscription *Subscription
+	}{
+		{
+			`{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"cart00000000001","payment_status":"paid","amount_total":1000,"subscription":"sub_1","customer":"cus_1"}}}`,
+			PAID, &Subscription{ID: "sub_1", Customer: "cus_1", Status: SUBSCRIPTION_ACTIVE},
+		},
+		{
+			`{"type":"invoice.paid","data":{"object":{"id":"in_2","billing_reason":"subscription_cycle","amount_paid":1000,"currency":"eur","subscription":"sub_1","customer":"cus_1","payment_intent":"pi_2"}}}`,
+			PAID, &Subscription{ID: "sub_1", Customer: "cus_1", Invoice: "in_2"},
+		},
+		{
+			`{"type":"customer.subscription.deleted","data":{"object":{"id":"sub_1","customer":"cus_1","status":"canceled","current_period_end":1717200000,"metadata":{"cart_id":"cart00000000001"}}}}`,
+			"", &Subscription{ID: "sub_1", CartID: "cart00000000001", Customer: "cus_1", Status: SUBSCRIPTION_CANCELED, CurrentPeriodEnd: 1717200000},
+		},
+	}
+
+	for _, tt := range cases {
+		payment, err := stripeCallback(settings, sign(tt.payload), []byte(tt.payload))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.status, payment.Status)
+		assert.Equal(t, tt.subscription, payment.Subscription)
+	}
+
+	// the cart of a subscription keeps the first invoice, its refund is found by it
+	payload := `{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"cart00000000001","payment_status":"paid","amount_total":1000,"subscription":"sub_1","invoice":"in_1"}}}`
+	payment, err := stripeCallback(settings, sign(payload), []byte(payload))
+	assert.NoError(t, err)
+	assert.Equal(t, "in_1", payment.MerchantID)
+
+	payload = `{"type":"charge.refunded","data":{"object":{"id":"ch_1","amount":1000,"amount_refunded":1000,"currency":"eur","payment_intent":"pi_1","invoice":"in_1"}}}`
+	payment, err = stripeCallback(settings, sign(payload), []byte(payload))
+	assert.NoError(t, err)
+	assert.Equal(t, "in_1", payment.MerchantID)
+	assert.Equal(t, REFUNDED, payment.Status)
+
+	// the first invoice is paid by the checkout session
+	payload = `{"type":"invoice.paid","data":{"object":{"id":"in_1","billing_reason":"subscription_create","subscription":"sub_1"}}}`
+	payment, err = stripeCallback(settings, sign(payload), []byte(payload))
+	assert.NoError(t, err)
+	assert.Nil(t, payment)
+
+	assert.False(t, SUBSCRIPTION_UNPAID.Active())
+	assert.True(t, SUBSCRIPTION_PAST_DUE.Active())
+}
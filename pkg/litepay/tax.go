@@ -0,0 +1,59 @@
+package litepay
+
+import (
+	"math"
+	"strconv"
+)
+
+// Tax is the tax charged on an item. Amount is the tax of the whole line in
+// minor units, it is part of the unit amount when Inclusive is set and is
+// charged on top of it otherwise.
+type Tax struct {
+	Name      string `json:"name"`
+	Rate      int    `json:"rate"` // hundredths of a percent, 2000 is 20%
+	Amount    int    `json:"amount"`
+	Inclusive bool   `json:"inclusive"`
+}
+
+// Title returns the name of the tax with its rate ("VAT 20%").
+func (t Tax) Title() string {
+	return t.Name + " " + FormatRate(t.Rate)
+}
+
+// FormatRate formats a rate in hundredths of a percent ("20%", "25.5%").
+func FormatRate(rate int) string {
+	return strconv.FormatFloat(float64(rate)/100, 'f', -1, 64) + "%"
+}
+
+// LineTax returns the tax of a line amount at the rate, rounded to the minor unit.
+// The amount includes the tax when inclusive is set.
+func LineTax(amount, rate int, inclusive bool) int {
+	if rate <= 0 {
+		return 0
+	}
+	if inclusive {
+		net := math.Round(float64(amount) * 10000 / float64(10000+rate))
+		return amount - int(net)
+	}
+	return int(math.Round(float64(amount) * float64(rate) / 10000))
+}
+
+// taxLines sums the taxes charged on top of the items by title, in the order
+// they first appear. Inclusive taxes are part of the item amounts and are left out.
+func taxLines(items []Item) []Tax {
+	lines := []Tax{}
+	index := map[string]int{}
+	for _, item := range items {
+		if item.Tax == nil || item.Tax.Inclusive || item.Tax.Amount == 0 {
+			continue
+		}
+		title := item.Tax.Title()
+		if i, ok := index[title]; ok {
+			lines[i].Amount += item.Tax.Amount
+			continue
+		}
+		index[title] = len(lines)
+		lines = append(lines, *item.Tax)
+	}
+	return lines
+}
@@ -0,0 +1,119 @@
+package litepay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LineTax(t *testing.T) {
+	cases := []struct {
+		amount    int
+		rate      int
+		inclusive bool
+		tax       int
+	}{
+		{1000, 2000, false, 200},
+		{1000, 2000, true, 167}, // 833 + 167
+		{999, 2550, false, 255}, // 254.745
+		{1275, 2100, true, 221}, // 1053.72 + 221.28
+		{1000, 0, false, 0},
+	}
+
+	for _, tt := range cases {
+		assert.Equal(t, tt.tax, LineTax(tt.amount, tt.rate, tt.inclusive), fmt.Sprintf("%d at %d", tt.amount, tt.rate))
+	}
+	assert.Equal(t, "25.5%", FormatRate(2550))
+	assert.Equal(t, "VAT 20%", Tax{Name: "VAT", Rate: 2000}.Title())
+}
+
+func Test_CartTax(t *testing.T) {
+	cart := Cart{
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1000}, Quantity: 2, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 400}},
+			{PriceData: Price{UnitAmount: 500}, Quantity: 1, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 100}},
+			{PriceData: Price{UnitAmount: 300}, Quantity: 1, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 50, Inclusive: true}},
+			{PriceData: Price{UnitAmount: 100}, Quantity: 1},
+		},
+	}
+
+	assert.Equal(t, 3400, cart.AmountTotal())
+	assert.Equal(t, 500, cart.AmountTax())
+	assert.Equal(t, []Tax{{Name: "VAT", Rate: 2000, Amount: 500}}, taxLines(cart.Items))
+}
+
+func Test_StripeTax(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"cs_test_1","amount_total":2400,"currency":"eur","payment_status":"unpaid","url":"https://checkout.stripe.com/pay"}`)
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithBaseURL(STRIPE, server.URL)
+	payment, err := cfg.Stripe("sk_test_key", SANDBOX, StripeCheckout{}).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1000, Product: Product{Name: "Book"}}, Quantity: 2, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 400}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2400, payment.AmountTotal)
+	assert.Equal(t, "VAT 20%", form.Get("line_items[1][price_data][product_data][name]"))
+	assert.Equal(t, "400", form.Get("line_items[1][price_data][unit_amount]"))
+	assert.Equal(t, "1", form.Get("line_items[1][quantity]"))
+}
+
+func Test_PaypalTax(t *testing.T) {
+	var order struct {
+		PurchaseUnits []struct {
+			Amount struct {
+				Value     string `json:"value"`
+				Breakdown struct {
+					ItemTotal struct {
+						Value string `json:"value"`
+					} `json:"item_total"`
+					TaxTotal struct {
+						Value string `json:"value"`
+					} `json:"tax_total"`
+				} `json:"breakdown"`
+			} `json:"amount"`
+		} `json:"purchase_units"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/v2/checkout/orders":
+			body, _ := io.ReadAll(r.Body)
+			assert.NoError(t, json.Unmarshal(body, &order))
+			fmt.Fprint(w, `{"id":"ORDER1","status":"PAYER_ACTION_REQUIRED"}`)
+		}
+	}))
+	defer server.Close()
+
+	cfg := New("", "", "").WithBaseURL(PAYPAL, server.URL)
+	payment, err := cfg.Paypal("id", "secret", SANDBOX).Pay(Cart{
+		ID:       "cart00000000001",
+		Currency: "EUR",
+		Items: []Item{
+			{PriceData: Price{UnitAmount: 1000}, Quantity: 2, Tax: &Tax{Name: "VAT", Rate: 2000, Amount: 400}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2400, payment.AmountTotal)
+	assert.Equal(t, "24.00", order.PurchaseUnits[0].Amount.Value)
+	assert.Equal(t, "20.00", order.PurchaseUnits[0].Amount.Breakdown.ItemTotal.Value)
+	assert.Equal(t, "4.00", order.PurchaseUnits[0].Amount.Breakdown.TaxTotal.Value)
+}
@@ -0,0 +1,24 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of the message.
+func Sign(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature was made by Sign with the same secret and message.
+func Verify(secret, message, signature string) bool {
+	expected, _ := hex.DecodeString(Sign(secret, message))
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(actual, expected)
+}
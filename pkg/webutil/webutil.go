@@ -1,6 +1,9 @@
 package webutil
 
 import (
+	"regexp"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/utils"
 )
@@ -44,3 +47,18 @@ func StatusBadRequest(c *fiber.Ctx, data any) error {
 func StatusInternalServerError(c *fiber.Ctx) error {
 	return Response(c, fiber.StatusInternalServerError, utils.StatusMessage(fiber.StatusInternalServerError), nil)
 }
+
+// languagePattern is a language tag of the Accept-Language header ("de", "pt-BR", "es-419").
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,4})?$`)
+
+// Language returns the preferred language of the request from its
+// Accept-Language header ("de", "pt-BR"), or an empty string.
+func Language(c *fiber.Ctx) string {
+	first, _, _ := strings.Cut(c.Get(fiber.HeaderAcceptLanguage), ",")
+	tag, _, _ := strings.Cut(first, ";")
+	tag = strings.TrimSpace(tag)
+	if !languagePattern.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
@@ -11,6 +11,9 @@ export { default as PageAdd } from "./page/Add.vue";
 export { default as PageSeo } from "./page/Seo.vue";
 export { default as PageUpdate } from "./page/Update.vue";
 
+// coupon section
+export { default as CouponForm } from "./coupon/Form.vue";
+
 // product section
 export { default as ProductAdd } from "./product/Add.vue";
 export { default as ProductDigital } from "./product/Digital.vue";
@@ -22,6 +25,9 @@ export { default as ProductView } from "./product/View.vue";
 export { default as Letter } from "./setting/Letter.vue";
 export { default as Paypal } from "./setting/Paypal.vue";
 export { default as Spectrocoin } from "./setting/Spectrocoin.vue";
+export { default as BTCPay } from "./setting/BTCPay.vue";
+export { default as Manual } from "./setting/Manual.vue";
+export { default as Mock } from "./setting/Mock.vue";
 export { default as Stripe } from "./setting/Stripe.vue";
 
 // other section
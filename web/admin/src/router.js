@@ -29,6 +29,18 @@ const router = createRouter({
       meta: { layout: "Main", ico: "cart" },
       component: () => import("@/pages/Carts.vue"),
     },
+    {
+      path: "/subscriptions",
+      name: "subscriptions",
+      meta: { layout: "Main", ico: "arrow-path" },
+      component: () => import("@/pages/Subscriptions.vue"),
+    },
+    {
+      path: "/coupons",
+      name: "coupons",
+      meta: { layout: "Main", ico: "fire" },
+      component: () => import("@/pages/Coupons.vue"),
+    },
     {
       path: "/pages",
       name: "pages",
@@ -68,6 +80,12 @@ const router = createRouter({
           meta: { ico: "money", title: "Payment" },
           component: () => import('@/pages/settings/payment.vue')
         },
+        {
+          path: 'tax',
+          name: 'settingsTax',
+          meta: { ico: "queue-list", title: "Taxes" },
+          component: () => import('@/pages/settings/tax.vue')
+        },
         {
           path: 'webhook',
           name: 'settingsWebhook',
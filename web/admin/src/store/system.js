@@ -4,6 +4,7 @@ import { defineStore } from 'pinia';
 export const useSystemStore = defineStore('system', () => {
   const version = ref({})
   const payments = ref({})
+  const sandbox = ref([])
 
-  return { version, payments }
+  return { version, payments, sandbox }
 })
\ No newline at end of file
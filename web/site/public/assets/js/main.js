@@ -21,11 +21,23 @@ const App = {
       socials: JSON.parse(sessionStorage.getItem('socials')) || ref([]),
       payments: ref([]),
       title: sessionStorage.getItem('title') || 'litecart',
+      tax: JSON.parse(sessionStorage.getItem('tax')) || ref({}),
 
       // cart
       cart: JSON.parse(localStorage.getItem('cart')) || ref([]),
       email: localStorage.getItem('email') || ref(''),
       provider: localStorage.getItem('provider') || ref(''),
+      coupon: ref(''),
+      country: localStorage.getItem('country') || ref(''),
+      vatId: ref(''),
+      paymentTitles: {
+        stripe: 'Stripe',
+        paypal: 'Paypal',
+        spectrocoin: 'Spectrocoin',
+        btcpay: 'Bitcoin',
+        manual: 'Bank transfer',
+        mock: 'Mock'
+      },
 
       // products
       load: false,
@@ -129,6 +141,9 @@ const App = {
 
         this.socials = resp.result.socials
         sessionStorage.setItem('socials', JSON.stringify(resp.result.socials))
+
+        this.tax = resp.result.tax
+        sessionStorage.setItem('tax', JSON.stringify(resp.result.tax))
       }
     },
 
@@ -167,7 +182,9 @@ const App = {
               id: product.id,
               name: product.name,
               slug: product.slug,
-              amount: product.amount,
+              amount: product.pay_what_you_want && product.chosen ? Math.round(Number(product.chosen) * 100) : product.amount,
+              custom: product.pay_what_you_want || false,
+              interval: product.billing === 'recurring' ? product.interval : '',
               image: image
             }
           })
@@ -215,13 +232,17 @@ const App = {
     async checkOut() {
       localStorage.setItem('email', this.email)
       localStorage.setItem('provider', this.provider)
+      localStorage.setItem('country', this.country)
 
       this.showOverlay()
 
       var cart = {
         email: this.email,
         provider: this.provider,
-        products: this.cart.map((item) => ({ id: item.id, quantity: 1 }))
+        coupon: this.coupon,
+        country: this.country.toUpperCase(),
+        vat_id: this.vatId,
+        products: this.cart.map((item) => (item.custom ? { id: item.id, quantity: 1, amount: item.amount } : { id: item.id, quantity: 1 }))
       }
 
       const response = await fetch(`/cart/payment`, {
@@ -237,11 +258,53 @@ const App = {
         window.location.href = resp.result
       } 
       
-      this.error = resp.message;
+      this.error = this.errorMessage(resp);
+    },
+
+    async repay(cartID, token, provider) {
+      this.showOverlay()
+
+      const response = await fetch(`/cart/${cartID}/pay`, {
+        credentials: 'include',
+        method: 'POST',
+        body: JSON.stringify({ token: token, provider: this.provider || provider }),
+        headers: {
+          'Content-Type': 'application/json'
+        }
+      })
+      const resp = await response.json()
+      if (resp.success) {
+        window.location.href = resp.result
+      }
+
+      this.error = this.errorMessage(resp, []);
+    },
+
+    // the checkout returns a message or the errors of the fields of the cart
+    errorMessage(resp, items = this.cart) {
+      if (typeof resp.result === 'string') {
+        return resp.result
+      }
+      if (!resp.result || typeof resp.result !== 'object') {
+        return resp.message
+      }
+
+      const messages = []
+      for (const [field, error] of Object.entries(resp.result)) {
+        if (field === 'products' && typeof error === 'object') {
+          for (const [index, productError] of Object.entries(error)) {
+            const name = items[index] ? items[index].name : 'Product'
+            messages.push(`${name}: ${Object.values(productError).join(', ')}`)
+          }
+          continue
+        }
+        messages.push(`${field.replace('_', ' ')}: ${error}`)
+      }
+      return messages.join('; ')
     },
 
     showPayments() {
-      if (!this.payments['stripe'] && !this.payments['paypal'] && !this.payments['spectrocoin']) {
+      if (!Object.keys(this.payments).some((name) => this.payments[name])) {
         localStorage.removeItem('provider')
         return false
       }
@@ -249,17 +312,9 @@ const App = {
     },
 
     showSelectPayments() {
-      if (this.payments['stripe'] && !this.payments['paypal'] && !this.payments['spectrocoin']) {
-        localStorage.setItem('provider', 'stripe')
-        return false
-      }
-      if (!this.payments['stripe'] && this.payments['paypal'] && !this.payments['spectrocoin']) {
-        localStorage.setItem('provider', 'paypal')
-        return false
-      }
-
-      if (!this.payments['stripe'] && !this.payments['paypal'] && this.payments['spectrocoin']) {
-        localStorage.setItem('provider', 'spectrocoin')
+      const active = Object.keys(this.payments).filter((name) => this.payments[name])
+      if (active.length === 1) {
+        localStorage.setItem('provider', active[0])
         return false
       }
       return true
@@ -289,6 +344,9 @@ const App = {
         this.currency = sessionStorage.getItem('currency')
         this.product = this.resp.result
         this.product.inCart = this.inCart(this.product.id)
+        if (this.product.pay_what_you_want) {
+          this.product.chosen = this.costFormat(this.product.amount)
+        }
         this.load = true
 
         if (this.product.seo.title) {